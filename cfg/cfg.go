@@ -1,9 +1,16 @@
 package cfg
 
 import (
+	"log"
+	"os"
 	"path/filepath"
 
+	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/storage"
+
 	"github.com/btcsuite/btcutil"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
 // Index ...
@@ -15,6 +22,7 @@ const (
 	CommitDB
 	NodeDB
 	ClaimScriptDB
+	IndexDB
 )
 
 var (
@@ -22,10 +30,18 @@ var (
 	defaultDataDir = filepath.Join(defaultHomeDir, "data")
 )
 
-// Config ...
-type Config struct {
-	path string
-}
+// ...
+const (
+	DefaultCacheSize   = 8 // MiB
+	DefaultWriteBuffer = 4 // MiB
+	DefaultUndoDepth   = 100
+	DefaultNodeCache   = 256 // MiB
+
+	DefaultSnapshotInterval = 10000
+	DefaultSnapshotChanges  = 100
+
+	DefaultPruneInterval = 1000
+)
 
 var datastores = map[Index]string{
 	ClaimScriptDB: "cs.db", // Exported from BTCD
@@ -33,9 +49,168 @@ var datastores = map[Index]string{
 	CommitDB: "commit.db",
 	TrieDB:   "trie.db",
 	NodeDB:   "nm.db",
+	IndexDB:  "idx.db",
+}
+
+// VerifyMode specifies how the databases are checked when the ClaimTrie is opened.
+type VerifyMode int
+
+// ...
+const (
+	// VerifyNone skips the check.
+	VerifyNone VerifyMode = iota
+
+	// VerifyQuick checks the root node of the Head commit exists in the trie
+	// database, and the node database has no changes beyond the Head commit.
+	VerifyQuick
+
+	// VerifyFull additionally rebuilds the trie from the change lists in the
+	// node database, and compares the root with the one of the Head commit.
+	VerifyFull
+)
+
+// RepairMode specifies how the databases are repaired if the check fails.
+type RepairMode int
+
+// ...
+const (
+	// RepairNone fails the opening of the ClaimTrie.
+	RepairNone RepairMode = iota
+
+	// RepairRebuildTrie rebuilds the trie database from the node database.
+	RepairRebuildTrie
+
+	// RepairTruncate truncates the change lists and commits back to the
+	// highest commit which the node database replays to. The commits are
+	// bisected, assuming the ones below a consistent commit are consistent
+	// too, so all nodes are replayed about log2(commits) times.
+	RepairTruncate
+)
+
+// Logger is the interface used by the ClaimTrie to report its status.
+// *log.Logger satisfies this interface.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Config holds the settings of the databases used by the ClaimTrie.
+type Config struct {
+	// DataDir is the directory where the databases are stored.
+	DataDir string
+
+	// Paths overrides the paths of individual databases.
+	Paths map[Index]string
+
+	// CacheSize and WriteBuffer are the sizes (in MiB) of the block cache
+	// and write buffer of each database.
+	CacheSize   int
+	WriteBuffer int
+
+	// Compression enables Snappy compression of the databases.
+	Compression bool
+
+	// InMemory keeps all databases in memory, and ignores the settings above.
+	// Nothing is persisted once the ClaimTrie is closed.
+	InMemory bool
+
+	// Params is the network profile of the consensus rules.
+	Params claim.Params
+
+	// Verify and Repair specify how the databases are checked, and repaired
+	// if needed, when the ClaimTrie is opened.
+	Verify VerifyMode
+	Repair RepairMode
+
+	// UndoDepth is the number of recent blocks kept with undo records, which
+	// can be reset cheaply. Resetting further falls back to replaying the
+	// change lists, as does any reset right after the ClaimTrie is opened,
+	// since the undo records are kept in memory only.
+	UndoDepth int
+
+	// NodeCache bounds the estimated memory (in MiB) of the nodes cached by
+	// the node manager. The evicted nodes are reloaded from the node
+	// database when needed. Zero means unbounded.
+	NodeCache int
+
+	// SnapshotInterval and SnapshotChanges tell when a node changed at a
+	// height is snapshotted: the number of heights, or the number of its
+	// changes, since its latest snapshot. The nodes are loaded from their
+	// latest snapshots, replaying only the changes after. Zero disables
+	// either of the conditions.
+	SnapshotInterval int
+	SnapshotChanges  int
+
+	// PruneDepth is the number of latest commits, whose tries are kept in
+	// the trie database. The nodes of older tries are pruned every
+	// PruneInterval heights, unless their commits are pinned. Zero keeps
+	// all tries.
+	PruneDepth    int
+	PruneInterval int
+
+	// HashWorkers is the number of goroutines hashing the dirty subtrees
+	// of the trie concurrently. Zero uses one per CPU.
+	HashWorkers int
+
+	// Logger receives the status messages. Nil disables logging.
+	Logger Logger
+}
+
+// DefaultConfig returns a Config with the default settings.
+func DefaultConfig() *Config {
+	return &Config{
+		DataDir:          defaultDataDir,
+		Paths:            map[Index]string{},
+		CacheSize:        DefaultCacheSize,
+		WriteBuffer:      DefaultWriteBuffer,
+		Compression:      true,
+		Params:           claim.MainNetParams,
+		Verify:           VerifyQuick,
+		Repair:           RepairNone,
+		UndoDepth:        DefaultUndoDepth,
+		NodeCache:        DefaultNodeCache,
+		SnapshotInterval: DefaultSnapshotInterval,
+		SnapshotChanges:  DefaultSnapshotChanges,
+		PruneInterval:    DefaultPruneInterval,
+		Logger:           log.New(os.Stdout, "", 0),
+	}
+}
+
+// Path returns the path of the database specified by idx.
+func (c *Config) Path(idx Index) string {
+	if path := c.Paths[idx]; path != "" {
+		return path
+	}
+	return filepath.Join(c.DataDir, datastores[idx])
+}
+
+// Options returns the leveldb options of the Config.
+func (c *Config) Options() *opt.Options {
+	o := &opt.Options{
+		BlockCacheCapacity: c.CacheSize * opt.MiB,
+		WriteBuffer:        c.WriteBuffer * opt.MiB,
+	}
+	if !c.Compression {
+		o.Compression = opt.NoCompression
+	}
+	return o
+}
+
+// Open opens the database specified by idx.
+func (c *Config) Open(idx Index) (storage.DB, error) {
+	if c.InMemory {
+		return storage.NewMemDB(), nil
+	}
+	path := c.Path(idx)
+	db, err := storage.OpenLevelDB(path, c.Options())
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't open %s", path)
+	}
+	return db, nil
 }
 
-// DefaultConfig ...
-func DefaultConfig(idx Index) string {
-	return filepath.Join(defaultDataDir, datastores[idx])
+// Printf logs with the Logger, if any.
+func (c *Config) Printf(format string, v ...interface{}) {
+	if c.Logger != nil {
+		c.Logger.Printf(format, v...)
+	}
 }
@@ -16,6 +16,10 @@ const (
 	UpdateClaim
 	AddSupport
 	SpendSupport
+
+	// MergeNode merges the node named by the Value into the node of Name.
+	// It's generated at the normalization fork.
+	MergeNode
 )
 
 var names = map[Cmd]string{
@@ -24,6 +28,7 @@ var names = map[Cmd]string{
 	UpdateClaim:  "+U",
 	AddSupport:   "+S",
 	SpendSupport: "-S",
+	MergeNode:    "+M",
 }
 
 // Change represent a record of changes to the node of Name at Height.
@@ -6,24 +6,29 @@ import (
 	"fmt"
 
 	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/storage"
 
 	"github.com/pkg/errors"
-	"github.com/syndtr/goleveldb/leveldb"
 )
 
 // List ...
 type List struct {
-	db   *leveldb.DB
+	db   storage.DB
 	name string
 	chgs []*Change
 	err  error
 }
 
 // NewChangeList ...
-func NewChangeList(db *leveldb.DB, name string) *List {
+func NewChangeList(db storage.DB, name string) *List {
 	return &List{db: db, name: name}
 }
 
+// Err returns the first error occurred in loading or saving the list.
+func (cl *List) Err() error {
+	return cl.err
+}
+
 // Changes returns the Changes in the list.
 func (cl *List) Changes() []*Change {
 	return cl.chgs
@@ -70,9 +75,9 @@ func (cl *List) Dump() *List {
 	return cl
 }
 
-func loadChanges(db *leveldb.DB, name string) ([]*Change, error) {
-	data, err := db.Get([]byte(name), nil)
-	if err == leveldb.ErrNotFound {
+func loadChanges(db storage.DB, name string) ([]*Change, error) {
+	data, err := db.Get([]byte(name))
+	if err == storage.ErrNotFound {
 		return nil, nil
 	} else if err != nil {
 		return nil, errors.Wrapf(err, "db.Get(%s)", name)
@@ -84,10 +89,10 @@ func loadChanges(db *leveldb.DB, name string) ([]*Change, error) {
 	return chgs, nil
 }
 
-func saveChanges(db *leveldb.DB, name string, chgs []*Change) error {
+func saveChanges(db storage.DB, name string, chgs []*Change) error {
 	buf := bytes.NewBuffer(nil)
 	if err := gob.NewEncoder(buf).Encode(&chgs); err != nil {
 		return errors.Wrapf(err, "gob.Decode(&blk)")
 	}
-	return errors.Wrapf(db.Put([]byte(name), buf.Bytes(), nil), "db.put(%s, buf)", name)
+	return errors.Wrapf(db.Put([]byte(name), buf.Bytes()), "db.put(%s, buf)", name)
 }
@@ -28,6 +28,10 @@ type Claim struct {
 	Accepted Height
 	Value    []byte
 
+	// Created is the height at which the claim was first accepted.
+	// Unlike Accepted, it's kept across the updates of the claim.
+	Created Height
+
 	EffAmt   Amount
 	ActiveAt Height
 }
@@ -37,21 +41,10 @@ func (c *Claim) setID(id ID) *Claim             { c.ID = id; return c }
 func (c *Claim) setAmt(amt Amount) *Claim       { c.Amt = amt; return c }
 func (c *Claim) setAccepted(ht Height) *Claim   { c.Accepted = ht; return c }
 func (c *Claim) setActiveAt(ht Height) *Claim   { c.ActiveAt = ht; return c }
+func (c *Claim) setCreated(ht Height) *Claim    { c.Created = ht; return c }
 func (c *Claim) setValue(val []byte) *Claim     { c.Value = val; return c }
 func (c *Claim) String() string                 { return claimToString(c) }
 
-func (c *Claim) expireAt() Height {
-	if c.Accepted+paramOriginalClaimExpirationTime > paramExtendedClaimExpirationForkHeight {
-		return c.Accepted + paramExtendedClaimExpirationTime
-	}
-	return c.Accepted + paramOriginalClaimExpirationTime
-}
-
-// IsActiveAt ...
-func IsActiveAt(c *Claim, ht Height) bool {
-	return c != nil && c.ActiveAt <= ht && c.expireAt() > ht
-}
-
 func equal(a, b *Claim) bool {
 	if a != nil && b != nil {
 		return a.OutPoint == b.OutPoint
@@ -9,6 +9,10 @@ var (
 	// ErrNotFound is returned when the Claim or Support is not found.
 	ErrNotFound = fmt.Errorf("not found")
 
+	// ErrClaimNotFound is returned when no claim matches a query, such as a
+	// name, an ID or a URL.
+	ErrClaimNotFound = fmt.Errorf("claim not found")
+
 	// ErrDuplicate is returned when the Claim or Support already exists in the node.
 	ErrDuplicate = fmt.Errorf("duplicate")
 )
@@ -8,7 +8,8 @@ import (
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
-func calNodeHash(op OutPoint, tookover Height) *chainhash.Hash {
+// NodeHash returns the value hash of a node, which is taken by the claim of op at tookover.
+func NodeHash(op OutPoint, tookover Height) *chainhash.Hash {
 	txHash := chainhash.DoubleHashH(op.Hash[:])
 
 	nOut := []byte(strconv.Itoa(int(op.Index)))
@@ -26,3 +27,52 @@ func calNodeHash(op OutPoint, tookover Height) *chainhash.Hash {
 	hh := chainhash.DoubleHashH(h)
 	return &hh
 }
+
+// MerkleRoot returns the root of the Merkle tree of the hashes.
+// Similar to the transactions of a block, the last hash of a level is paired
+// with itself if the level has an odd number of hashes.
+func MerkleRoot(hashes []*chainhash.Hash) *chainhash.Hash {
+	if len(hashes) == 0 {
+		return nil
+	}
+	for len(hashes) > 1 {
+		hashes = merkleLevel(hashes)
+	}
+	return hashes[0]
+}
+
+// MerkleBranch returns the sibling hashes along the path from the i-th hash
+// to the root of the Merkle tree of the hashes.
+func MerkleBranch(hashes []*chainhash.Hash, i int) []*chainhash.Hash {
+	var branch []*chainhash.Hash
+	for ; len(hashes) > 1; i /= 2 {
+		sibling := i ^ 1
+		if sibling == len(hashes) {
+			sibling = i
+		}
+		branch = append(branch, hashes[sibling])
+		hashes = merkleLevel(hashes)
+	}
+	return branch
+}
+
+// MerkleParent returns the hash of the parent of the left and right nodes.
+func MerkleParent(left, right *chainhash.Hash) *chainhash.Hash {
+	h := make([]byte, 0, sha256.Size*2)
+	h = append(h, left[:]...)
+	h = append(h, right[:]...)
+	hh := chainhash.DoubleHashH(h)
+	return &hh
+}
+
+func merkleLevel(hashes []*chainhash.Hash) []*chainhash.Hash {
+	next := make([]*chainhash.Hash, 0, (len(hashes)+1)/2)
+	for i := 0; i < len(hashes); i += 2 {
+		right := hashes[i]
+		if i+1 < len(hashes) {
+			right = hashes[i+1]
+		}
+		next = append(next, MerkleParent(hashes[i], right))
+	}
+	return next
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"strings"
 
 	"github.com/btcsuite/btcutil"
 )
@@ -23,6 +24,20 @@ func NewID(op OutPoint) ID {
 	return id
 }
 
+// CheckIDPrefix returns ErrInvalidID if the prefix of an ID, in the
+// hexadecimal form, isn't hexadecimal or is longer than an ID.
+func CheckIDPrefix(prefix string) error {
+	if len(prefix) > 2*len(ID{}) {
+		return ErrInvalidID
+	}
+	for _, ch := range prefix {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", ch) {
+			return ErrInvalidID
+		}
+	}
+	return nil
+}
+
 // NewIDFromString returns a Claim ID from a string.
 func NewIDFromString(s string) (ID, error) {
 	var id ID
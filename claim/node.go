@@ -2,6 +2,7 @@ package claim
 
 import (
 	"math"
+	"sort"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/pkg/errors"
@@ -9,6 +10,8 @@ import (
 
 // Node ...
 type Node struct {
+	params *Params
+
 	name string
 
 	height Height
@@ -23,9 +26,32 @@ type Node struct {
 	removed List
 }
 
-// NewNode returns a new Node.
-func NewNode(name string) *Node {
-	return &Node{name: name}
+// NewNode returns a new Node governed by the params p.
+func NewNode(name string, p *Params) *Node {
+	return &Node{params: p, name: name}
+}
+
+// Clone returns a deep copy of the Node.
+func (n *Node) Clone() *Node {
+	dup := *n
+	copies := map[*Claim]*Claim{}
+	clone := func(l List) List {
+		var ret List
+		for _, c := range l {
+			v := *c
+			copies[c] = &v
+			ret = append(ret, &v)
+		}
+		return ret
+	}
+	dup.claims, dup.supports, dup.removed = clone(n.claims), clone(n.supports), clone(n.removed)
+	if n.best != nil {
+		if dup.best = copies[n.best]; dup.best == nil {
+			v := *n.best
+			dup.best = &v
+		}
+	}
+	return &dup
 }
 
 // Name returns the Name where the Node blongs.
@@ -33,6 +59,11 @@ func (n *Node) Name() string {
 	return n.name
 }
 
+// Params returns the parameters governing the Node.
+func (n *Node) Params() *Params {
+	return n.params
+}
+
 // Height returns the current height.
 func (n *Node) Height() Height {
 	return n.height
@@ -53,6 +84,19 @@ func (n *Node) Claims() List {
 	return n.claims
 }
 
+// ActiveClaims returns the active claims at the current height, ordered by
+// their bids. The BestClaim, if any, comes first.
+func (n *Node) ActiveClaims() List {
+	var l List
+	for _, c := range n.claims {
+		if n.params.IsActiveAt(c, n.height) {
+			l = append(l, c)
+		}
+	}
+	sort.Slice(l, func(i, j int) bool { return outbids(l[i], l[j]) })
+	return l
+}
+
 // Supports returns the supports at the current height.
 func (n *Node) Supports() List {
 	return n.supports
@@ -64,9 +108,9 @@ func (n *Node) AddClaim(op OutPoint, amt Amount, val []byte) error {
 		return ErrDuplicate
 	}
 	accepted := n.height + 1
-	c := New(op, amt).setID(NewID(op)).setAccepted(accepted).setValue(val)
-	c.setActiveAt(accepted + calDelay(accepted, n.tookover))
-	if !IsActiveAt(n.best, accepted) {
+	c := New(op, amt).setID(NewID(op)).setAccepted(accepted).setCreated(accepted).setValue(val)
+	c.setActiveAt(accepted + n.params.calDelay(accepted, n.tookover))
+	if !n.params.IsActiveAt(n.best, accepted) {
 		c.setActiveAt(accepted)
 		n.best, n.tookover = c, accepted
 	}
@@ -105,7 +149,7 @@ func (n *Node) UpdateClaim(op OutPoint, amt Amount, id ID, val []byte) error {
 
 	accepted := n.height + 1
 	c.setOutPoint(op).setAmt(amt).setAccepted(accepted).setValue(val)
-	c.setActiveAt(accepted + calDelay(accepted, n.tookover))
+	c.setActiveAt(accepted + n.params.calDelay(accepted, n.tookover))
 	if n.best != nil && n.best.ID == id {
 		c.setActiveAt(n.tookover)
 	}
@@ -126,7 +170,7 @@ func (n *Node) AddSupport(op OutPoint, amt Amount, id ID) error {
 
 	accepted := n.height + 1
 	s := New(op, amt).setID(id).setAccepted(accepted)
-	s.setActiveAt(accepted + calDelay(accepted, n.tookover))
+	s.setActiveAt(accepted + n.params.calDelay(accepted, n.tookover))
 	if n.best != nil && n.best.ID == id {
 		s.setActiveAt(accepted)
 	}
@@ -143,6 +187,26 @@ func (n *Node) SpendSupport(op OutPoint) error {
 	return ErrNotFound
 }
 
+// Merge moves the claims and supports of node o into the Node, keeping their
+// accepted and activation heights. It's used when the names of the nodes
+// collide at the normalization fork. The bidding happens at the next height.
+func (n *Node) Merge(o *Node) error {
+	for _, v := range append(append(List{}, o.claims...), o.supports...) {
+		if Find(ByOP(v.OutPoint), n.claims, n.supports) != nil {
+			return ErrDuplicate
+		}
+	}
+	for _, c := range o.claims {
+		dup := *c
+		n.claims = append(n.claims, &dup)
+	}
+	for _, s := range o.supports {
+		dup := *s
+		n.supports = append(n.supports, &dup)
+	}
+	return nil
+}
+
 // AdjustTo increments current height until it reaches the specific height.
 func (n *Node) AdjustTo(ht Height) *Node {
 	if ht <= n.height {
@@ -169,7 +233,7 @@ func (n *Node) NextUpdate() Height {
 	next := Height(math.MaxInt32)
 	min := func(l List) Height {
 		for _, v := range l {
-			exp := v.expireAt()
+			exp := n.params.expireAt(v)
 			if n.height >= exp {
 				continue
 			}
@@ -192,12 +256,12 @@ func (n *Node) NextUpdate() Height {
 
 func (n *Node) bid() {
 	for {
-		if n.best == nil || n.height >= n.best.expireAt() {
+		if n.best == nil || n.height >= n.params.expireAt(n.best) {
 			n.best, n.tookover = nil, n.height
 			updateActiveHeights(n, n.claims, n.supports)
 		}
-		updateEffectiveAmounts(n.height, n.claims, n.supports)
-		c := findCandiadte(n.height, n.claims)
+		updateEffectiveAmounts(n.params, n.height, n.claims, n.supports)
+		c := findCandiadte(n.params, n.height, n.claims)
 		if equal(n.best, c) {
 			break
 		}
@@ -207,15 +271,15 @@ func (n *Node) bid() {
 	n.removed = nil
 }
 
-func updateEffectiveAmounts(ht Height, claims, supports List) {
+func updateEffectiveAmounts(p *Params, ht Height, claims, supports List) {
 	for _, c := range claims {
 		c.EffAmt = 0
-		if !IsActiveAt(c, ht) {
+		if !p.IsActiveAt(c, ht) {
 			continue
 		}
 		c.EffAmt = c.Amt
 		for _, s := range supports {
-			if !IsActiveAt(s, ht) || s.ID != c.ID {
+			if !p.IsActiveAt(s, ht) || s.ID != c.ID {
 				continue
 			}
 			c.EffAmt += s.Amt
@@ -229,7 +293,7 @@ func updateActiveHeights(n *Node, lists ...List) {
 			if v.ActiveAt < n.height {
 				continue
 			}
-			v.ActiveAt = v.Accepted + calDelay(n.height, n.tookover)
+			v.ActiveAt = v.Accepted + n.params.calDelay(n.height, n.tookover)
 			if v.ActiveAt < n.height {
 				v.ActiveAt = n.height
 			}
@@ -237,43 +301,50 @@ func updateActiveHeights(n *Node, lists ...List) {
 	}
 }
 
-func findCandiadte(ht Height, claims List) *Claim {
+func findCandiadte(p *Params, ht Height, claims List) *Claim {
 	var c *Claim
 	for _, v := range claims {
 		switch {
-		case !IsActiveAt(v, ht):
-			continue
-		case c == nil:
-			c = v
-		case v.EffAmt > c.EffAmt:
-			c = v
-		case v.EffAmt < c.EffAmt:
-			continue
-		case v.Accepted < c.Accepted:
-			c = v
-		case v.Accepted > c.Accepted:
+		case !p.IsActiveAt(v, ht):
 			continue
-		case outPointLess(c.OutPoint, v.OutPoint):
+		case c == nil || outbids(v, c):
 			c = v
 		}
 	}
 	return c
 }
 
-func calDelay(curr, tookover Height) Height {
-	delay := (curr - tookover) / paramActiveDelayFactor
-	if delay > paramMaxActiveDelay {
-		return paramMaxActiveDelay
+// outbids returns true if the active claim a ranks before the active claim b.
+func outbids(a, b *Claim) bool {
+	switch {
+	case a.EffAmt != b.EffAmt:
+		return a.EffAmt > b.EffAmt
+	case a.Accepted != b.Accepted:
+		return a.Accepted < b.Accepted
 	}
-	return delay
+	return outPointLess(b.OutPoint, a.OutPoint)
 }
 
 // Hash calculates the Hash value based on the OutPoint and when it tookover.
+// From the AllClaimsInMerkleForkHeight, which only the regtest reaches, it's
+// the Merkle root of ClaimHashes.
 func (n *Node) Hash() *chainhash.Hash {
 	if n.best == nil {
 		return nil
 	}
-	return calNodeHash(n.best.OutPoint, n.tookover)
+	if n.height < n.params.AllClaimsInMerkleForkHeight {
+		return NodeHash(n.best.OutPoint, n.tookover)
+	}
+	return MerkleRoot(n.ClaimHashes())
+}
+
+// ClaimHashes returns the hashes of the ActiveClaims, in the same order.
+func (n *Node) ClaimHashes() []*chainhash.Hash {
+	var hashes []*chainhash.Hash
+	for _, c := range n.ActiveClaims() {
+		hashes = append(hashes, NodeHash(c.OutPoint, n.tookover))
+	}
+	return hashes
 }
 
 func (n *Node) String() string {
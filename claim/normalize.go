@@ -0,0 +1,17 @@
+package claim
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize returns the name in Unicode NFD form with its case folded.
+// Names that are not valid UTF-8 are returned as is.
+func Normalize(name string) string {
+	if !utf8.ValidString(name) {
+		return name
+	}
+	return cases.Fold().String(norm.NFD.String(name))
+}
@@ -1,14 +1,6 @@
 package claim
 
-// Param ...
-type Param func()
-
-// SetParams ...
-func SetParams(params ...Param) {
-	for _, p := range params {
-		p()
-	}
-}
+import "math"
 
 // ...
 const (
@@ -23,47 +15,118 @@ const (
 	DefaultExtendedClaimExpirationForkHeight Height = 400155
 )
 
-var (
-	paramMaxActiveDelay                    = DefaultMaxActiveDelay
-	paramActiveDelayFactor                 = DefaultActiveDelayFactor
-	paramOriginalClaimExpirationTime       = DefaultOriginalClaimExpirationTime
-	paramExtendedClaimExpirationTime       = DefaultExtendedClaimExpirationTime
-	paramExtendedClaimExpirationForkHeight = DefaultExtendedClaimExpirationForkHeight
-)
+// Params bundles the consensus parameters of a network.
+// Nodes built with different Params can coexist in the same process.
+type Params struct {
+	Name string
 
-// ResetParams ...
-func ResetParams() Param {
-	return func() {
-		paramMaxActiveDelay = DefaultMaxActiveDelay
-		paramActiveDelayFactor = DefaultActiveDelayFactor
+	// Version identifies the revision of the Params of the network, along
+	// with its Name. The databases are checked against these two only, so it
+	// must be bumped whenever a consensus height or duration of the network
+	// changes, or a database built with the earlier ones opens without error.
+	// The profiles start from zero, which matches the databases built before
+	// it was introduced.
+	Version int
 
-		paramOriginalClaimExpirationTime = DefaultOriginalClaimExpirationTime
-		paramExtendedClaimExpirationTime = DefaultExtendedClaimExpirationTime
-		paramExtendedClaimExpirationForkHeight = DefaultExtendedClaimExpirationForkHeight
-	}
+	MaxActiveDelay    Height
+	ActiveDelayFactor Height
+
+	OriginalClaimExpirationTime       Height
+	ExtendedClaimExpirationTime       Height
+	ExtendedClaimExpirationForkHeight Height
+
+	// NormalizedNameForkHeight is the height from which names are normalized.
+	NormalizedNameForkHeight Height
+
+	// AllClaimsInMerkleForkHeight is the height from which the value hash of
+	// a node commits to all of its active claims, instead of the best one.
+	//
+	// The fork of lbrycrd also changes how the trie nodes are hashed, which
+	// isn't implemented, so only the regtest reaches it. The other networks
+	// have it at NeverHeight until then.
+	AllClaimsInMerkleForkHeight Height
 }
 
-// MaxActiveDelay ...
-func MaxActiveDelay(h Height) Param {
-	return func() { paramMaxActiveDelay = h }
+// NeverHeight is a height which is never reached, for the forks which aren't
+// supported on a network.
+const NeverHeight Height = math.MaxInt32
+
+// MainNetParams defines the parameters of the LBRY main network.
+var MainNetParams = Params{
+	Name: "mainnet",
+
+	MaxActiveDelay:    DefaultMaxActiveDelay,
+	ActiveDelayFactor: DefaultActiveDelayFactor,
+
+	OriginalClaimExpirationTime:       DefaultOriginalClaimExpirationTime,
+	ExtendedClaimExpirationTime:       DefaultExtendedClaimExpirationTime,
+	ExtendedClaimExpirationForkHeight: DefaultExtendedClaimExpirationForkHeight,
+
+	NormalizedNameForkHeight:    539940,
+	AllClaimsInMerkleForkHeight: NeverHeight, // 658300 on lbrycrd
 }
 
-// ActiveDelayFactor ...
-func ActiveDelayFactor(f Height) Param {
-	return func() { paramActiveDelayFactor = f }
+// TestNetParams defines the parameters of the LBRY test network.
+var TestNetParams = Params{
+	Name: "testnet",
+
+	MaxActiveDelay:    DefaultMaxActiveDelay,
+	ActiveDelayFactor: DefaultActiveDelayFactor,
+
+	OriginalClaimExpirationTime:       DefaultOriginalClaimExpirationTime,
+	ExtendedClaimExpirationTime:       DefaultExtendedClaimExpirationTime,
+	ExtendedClaimExpirationForkHeight: 278160,
+
+	NormalizedNameForkHeight:    993380,
+	AllClaimsInMerkleForkHeight: NeverHeight, // 1198560 on lbrycrd
 }
 
-// OriginalClaimExpirationTime ...
-func OriginalClaimExpirationTime(h Height) Param {
-	return func() { paramOriginalClaimExpirationTime = h }
+// RegTestParams defines the parameters of the LBRY regression test network.
+var RegTestParams = Params{
+	Name: "regtest",
+
+	MaxActiveDelay:    DefaultMaxActiveDelay,
+	ActiveDelayFactor: DefaultActiveDelayFactor,
+
+	OriginalClaimExpirationTime:       500,
+	ExtendedClaimExpirationTime:       600,
+	ExtendedClaimExpirationForkHeight: 800,
+
+	NormalizedNameForkHeight:    250,
+	AllClaimsInMerkleForkHeight: 350,
 }
 
-// ExtendedClaimExpirationTime ...
-func ExtendedClaimExpirationTime(h Height) Param {
-	return func() { paramExtendedClaimExpirationTime = h }
+// Networks maps the names of the known networks to their parameters.
+var Networks = map[string]Params{
+	MainNetParams.Name: MainNetParams,
+	TestNetParams.Name: TestNetParams,
+	RegTestParams.Name: RegTestParams,
 }
 
-// ExtendedClaimExpirationForkHeight ...
-func ExtendedClaimExpirationForkHeight(at Height) Param {
-	return func() { paramExtendedClaimExpirationForkHeight = at }
+// IsActiveAt returns true if the Claim (or Support) is active at height ht.
+func (p *Params) IsActiveAt(c *Claim, ht Height) bool {
+	return c != nil && c.ActiveAt <= ht && p.expireAt(c) > ht
+}
+
+// NormalizeName returns the name used as the key of the node at height ht.
+func (p *Params) NormalizeName(name string, ht Height) string {
+	if ht < p.NormalizedNameForkHeight {
+		return name
+	}
+	return Normalize(name)
+}
+
+func (p *Params) expireAt(c *Claim) Height {
+	if c.Accepted+p.OriginalClaimExpirationTime > p.ExtendedClaimExpirationForkHeight {
+		return c.Accepted + p.ExtendedClaimExpirationTime
+	}
+	return c.Accepted + p.OriginalClaimExpirationTime
+}
+
+func (p *Params) calDelay(curr, tookover Height) Height {
+	delay := (curr - tookover) / p.ActiveDelayFactor
+	if delay > p.MaxActiveDelay {
+		return p.MaxActiveDelay
+	}
+	return delay
 }
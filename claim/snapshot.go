@@ -0,0 +1,64 @@
+package claim
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/pkg/errors"
+)
+
+// snapshot is the persisted form of a Node.
+type snapshot struct {
+	Name     string
+	Height   Height
+	Best     *Claim
+	Tookover Height
+	Claims   List
+	Supports List
+	Removed  List
+}
+
+// MarshalBinary encodes the Node, so it can be restored by UnmarshalNode
+// without replaying its changes.
+func (n *Node) MarshalBinary() ([]byte, error) {
+	s := snapshot{
+		Name:     n.name,
+		Height:   n.height,
+		Best:     n.best,
+		Tookover: n.tookover,
+		Claims:   n.claims,
+		Supports: n.supports,
+		Removed:  n.removed,
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(&s); err != nil {
+		return nil, errors.Wrapf(err, "gob.Encode()")
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalNode decodes a Node encoded by MarshalBinary, which is governed
+// by the params p.
+func UnmarshalNode(data []byte, p *Params) (*Node, error) {
+	var s snapshot
+	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&s); err != nil {
+		return nil, errors.Wrapf(err, "gob.Decode()")
+	}
+	n := &Node{
+		params:   p,
+		name:     s.Name,
+		height:   s.Height,
+		best:     s.Best,
+		tookover: s.Tookover,
+		claims:   s.Claims,
+		supports: s.Supports,
+		removed:  s.Removed,
+	}
+	// The best claim is referenced by the node, rather than copied.
+	if n.best != nil {
+		if c := Find(ByOP(n.best.OutPoint), n.claims); c != nil {
+			n.best = c
+		}
+	}
+	return n, nil
+}
@@ -1,74 +1,106 @@
 package claimtrie
 
 import (
-	"fmt"
-
 	"github.com/lbryio/claimtrie/cfg"
 	"github.com/lbryio/claimtrie/change"
 	"github.com/lbryio/claimtrie/claim"
 	"github.com/lbryio/claimtrie/nodemgr"
+	"github.com/lbryio/claimtrie/proof"
+	"github.com/lbryio/claimtrie/storage"
 	"github.com/lbryio/claimtrie/trie"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/pkg/errors"
-	"github.com/syndtr/goleveldb/leveldb"
 )
 
 // ClaimTrie implements a Merkle Trie supporting linear history of commits.
 type ClaimTrie struct {
+	cfg *cfg.Config
+
 	cm *CommitMgr
 	nm *nodemgr.NodeMgr
 	tr *trie.Trie
 
+	// bufs holds the writes to the trie, node, commit and index databases until
+	// they are flushed together at each commit.
+	bufs []*storage.Buffer
+
 	cleanup func() error
 }
 
-// New returns a ClaimTrie.
-func New() (*ClaimTrie, error) {
-	path := cfg.DefaultConfig(cfg.TrieDB)
-	dbTrie, err := leveldb.OpenFile(path, nil)
-	if err != nil {
-		return nil, errors.Wrapf(err, "can't open %s", path)
+// New returns a ClaimTrie with the databases specified by the Config.
+// A nil Config is equivalent to cfg.DefaultConfig().
+func New(c *cfg.Config) (*ClaimTrie, error) {
+	if c == nil {
+		c = cfg.DefaultConfig()
 	}
-
-	path = cfg.DefaultConfig(cfg.NodeDB)
-	dbNodeMgr, err := leveldb.OpenFile(path, nil)
+	// The order has to match the one when the write-ahead log was written.
+	// Databases added later are appended, so older logs can still be replayed.
+	var dbs []storage.DB
+	for _, idx := range []cfg.Index{cfg.TrieDB, cfg.NodeDB, cfg.CommitDB, cfg.IndexDB} {
+		db, err := c.Open(idx)
+		if err != nil {
+			closeAll(dbs)
+			return nil, err
+		}
+		dbs = append(dbs, db)
+	}
+	ct, err := open(c, dbs)
 	if err != nil {
-		return nil, errors.Wrapf(err, "can't open %s", path)
+		closeAll(dbs)
+		return nil, err
 	}
+	return ct, nil
+}
 
-	path = cfg.DefaultConfig(cfg.CommitDB)
-	dbCommit, err := leveldb.OpenFile(path, nil)
-	if err != nil {
-		return nil, errors.Wrapf(err, "can't open %s", path)
+func open(c *cfg.Config, dbs []storage.DB) (*ClaimTrie, error) {
+	if ht, err := recoverWAL(dbs[2], dbs); err != nil {
+		return nil, errors.Wrapf(err, "recoverWAL()")
+	} else if ht >= 0 {
+		c.Printf("Recovered commit %d from write-ahead log.\n", ht)
+	}
+	bufs := make([]*storage.Buffer, len(dbs))
+	for i, db := range dbs {
+		bufs[i] = storage.NewBuffer(db)
 	}
+	dbTrie, dbNodeMgr, dbCommit, dbIndex := bufs[0], bufs[1], bufs[2], bufs[3]
 
 	cm := NewCommitMgr(dbCommit)
+	if err := cm.CheckParams(c.Params); err != nil {
+		return nil, errors.Wrapf(err, "cm.CheckParams()")
+	}
 	if err := cm.Load(); err != nil {
 		return nil, errors.Wrapf(err, "cm.Load()")
 	}
-	fmt.Printf("%d of commits loaded. Head: %d\n", len(cm.commits), cm.head.Meta.Height)
+	c.Printf("Commits loaded. Head: %d\n", cm.head.Meta.Height)
 
-	nm := nodemgr.New(dbNodeMgr)
-	nm.Load(cm.head.Meta.Height)
-	fmt.Printf("%d of nodes loaded.\n", nm.Size())
+	params := c.Params
+	nm := nodemgr.New(dbNodeMgr, dbIndex, &params)
+	nm.SetUndoDepth(c.UndoDepth)
+	nm.SetCacheSize(c.NodeCache << 20)
+	nm.SetSnapshotPolicy(claim.Height(c.SnapshotInterval), c.SnapshotChanges)
+	if err := nm.Load(cm.head.Meta.Height); err != nil {
+		return nil, errors.Wrapf(err, "nm.Load()")
+	}
+	c.Printf("%d of nodes cached.\n", nm.Size())
 
 	tr := trie.New(nm, dbTrie)
+	if c.HashWorkers > 0 {
+		tr.SetWorkers(c.HashWorkers)
+	}
 	tr.SetRoot(cm.Head().MerkleRoot)
-	fmt.Printf("ClaimTrie Root: %s.\n", tr.MerkleHash())
+	c.Printf("ClaimTrie Root: %s.\n", tr.MerkleHash())
 
 	ct := &ClaimTrie{
+		cfg: c,
+
 		cm: cm,
 		nm: nm,
 		tr: tr,
 
+		bufs: bufs,
+
 		cleanup: func() error {
-			if err := nm.Save(); err != nil {
-				return errors.Wrapf(err, "nm.Save()")
-			}
-			if err := cm.Save(); err != nil {
-				return errors.Wrapf(err, "cm.Save()")
-			}
 			if err := dbTrie.Close(); err != nil {
 				return errors.Wrapf(err, "dbTrie.Close()")
 			}
@@ -78,17 +110,47 @@ func New() (*ClaimTrie, error) {
 			if err := dbCommit.Close(); err != nil {
 				return errors.Wrapf(err, "dbCommit.Close()")
 			}
+			if err := dbIndex.Close(); err != nil {
+				return errors.Wrapf(err, "dbIndex.Close()")
+			}
 			return nil
 		},
 	}
+	if err := ct.flush(); err != nil {
+		return nil, errors.Wrapf(err, "flush()")
+	}
+	if err := ct.Verify(c.Verify); err != nil {
+		if c.Repair == cfg.RepairNone {
+			return nil, err
+		}
+		c.Printf("%s. Repairing...\n", err)
+		if err = ct.Repair(c.Repair); err != nil {
+			return nil, errors.Wrapf(err, "ct.Repair()")
+		}
+		c.Printf("Repaired. Head: %d, ClaimTrie Root: %s.\n", ct.Height(), ct.MerkleHash())
+	}
+	if err := ct.normalize(); err != nil {
+		return nil, errors.Wrapf(err, "ct.normalize()")
+	}
 	return ct, nil
 }
 
-// Close saves ClaimTrie state to database.
+func closeAll(dbs []storage.DB) {
+	for _, db := range dbs {
+		db.Close() // nolint : errchk
+	}
+}
+
+// Close closes the databases. Changes that haven't been committed are discarded.
 func (ct *ClaimTrie) Close() error {
 	return ct.cleanup()
 }
 
+// Params returns the network parameters of the ClaimTrie.
+func (ct *ClaimTrie) Params() *claim.Params {
+	return ct.nm.Params()
+}
+
 // Height returns the highest height of blocks commited to the ClaimTrie.
 func (ct *ClaimTrie) Height() claim.Height {
 	return ct.cm.Head().Meta.Height
@@ -144,7 +206,29 @@ func (ct *ClaimTrie) SpendSupport(name string, op claim.OutPoint) error {
 	return ct.modify(name, c)
 }
 
+// Spend spends the claim or support of op, whichever it is, in the ClaimTrie.
+// It returns ErrClaimNotFound if op is neither.
+func (ct *ClaimTrie) Spend(op claim.OutPoint) error {
+	e, err := ct.nm.LookupOutPoint(op)
+	if errors.Cause(err) == storage.ErrNotFound {
+		return errors.Wrapf(ErrClaimNotFound, "outpoint %s", op)
+	} else if err != nil {
+		return err
+	}
+	c := change.New(change.SpendClaim).SetOP(op)
+	if e.Kind == nodemgr.SupportKind {
+		c = change.New(change.SpendSupport).SetOP(op)
+	}
+	// The name in the index is the one of the node, which is normalized already.
+	return ct.apply(e.Name, c)
+}
+
 func (ct *ClaimTrie) modify(name string, c *change.Change) error {
+	return ct.apply(ct.Params().NormalizeName(name, ct.Height()+1), c)
+}
+
+// apply applies the change to the node of name, which has been normalized if needed.
+func (ct *ClaimTrie) apply(name string, c *change.Change) error {
 	c.SetHeight(ct.Height() + 1).SetName(name)
 	if err := ct.nm.ModifyNode(name, c); err != nil {
 		return err
@@ -159,25 +243,142 @@ func (ct *ClaimTrie) MerkleHash() *chainhash.Hash {
 }
 
 // Commit commits the current changes into database.
-func (ct *ClaimTrie) Commit(ht claim.Height) {
+// The writes to all databases are applied atomically.
+func (ct *ClaimTrie) Commit(ht claim.Height) error {
+	return ct.commit(CommitMeta{Height: ht})
+}
+
+// CommitBlock commits the current changes as the block of hash at the next
+// height. It returns ErrParentMismatch if the parent is not the Head block.
+func (ct *ClaimTrie) CommitBlock(hash, parent *chainhash.Hash) error {
+	return ct.commit(CommitMeta{Height: ct.Height() + 1, Hash: *hash, Parent: *parent})
+}
+
+func (ct *ClaimTrie) commit(meta CommitMeta) error {
+	ht := meta.Height
 	if ht < ct.Height() {
-		return
+		return ErrInvalidHeight
+	}
+	if ht == ct.Height() {
+		return nil
+	}
+	if err := ct.cm.CheckParent(meta); err != nil {
+		return err
+	}
+	// Stop right before the normalization fork to merge the nodes.
+	if fork := ct.Params().NormalizedNameForkHeight; ct.Height() < fork-1 && ht >= fork {
+		if err := ct.Commit(fork - 1); err != nil {
+			return err
+		}
 	}
 	for i := ct.Height() + 1; i <= ht; i++ {
-		ct.nm.CatchUp(i, ct.tr.Update)
+		if err := ct.nm.CatchUp(i, ct.tr.Update); err != nil {
+			return errors.Wrapf(err, "nm.CatchUp(%d)", i)
+		}
+		// The value hashes of all nodes change at the fork.
+		if i == ct.Params().AllClaimsInMerkleForkHeight {
+			for _, name := range ct.nm.Names() {
+				ct.tr.Update([]byte(name))
+			}
+		}
 	}
 	h := ct.MerkleHash()
-	ct.cm.Commit(ht, h)
+	if err := ct.cm.Commit(meta, h); err != nil {
+		return err
+	}
 	ct.tr.SetRoot(h)
+	if err := ct.flush(); err != nil {
+		return errors.Wrapf(err, "flush()")
+	}
+	if c := ct.cfg; c.PruneDepth > 0 && c.PruneInterval > 0 && ht%claim.Height(c.PruneInterval) == 0 {
+		n, err := ct.Prune(c.PruneDepth)
+		if err != nil {
+			return errors.Wrapf(err, "Prune(%d)", c.PruneDepth)
+		}
+		c.Printf("Pruned %d trie nodes at %d.\n", n, ht)
+	}
+	return ct.normalize()
 }
 
 // Reset resets the tip commit to a previous height specified.
+// Changes that haven't been committed are discarded.
 func (ct *ClaimTrie) Reset(ht claim.Height) error {
+	_, err := ct.reset(ht)
+	return err
+}
+
+// ResetBlock resets the tip commit to the one of the block hash, and returns
+// the orphaned commits, from the highest one.
+// Changes that haven't been committed are discarded.
+func (ct *ClaimTrie) ResetBlock(hash *chainhash.Hash) ([]*Commit, error) {
+	c, err := ct.cm.Find(hash)
+	if err != nil {
+		return nil, err
+	}
+	return ct.reset(c.Meta.Height)
+}
+
+func (ct *ClaimTrie) reset(ht claim.Height) ([]*Commit, error) {
 	if ht > ct.Height() {
-		return ErrInvalidHeight
+		return nil, ErrInvalidHeight
+	}
+	for _, b := range ct.bufs {
+		b.Discard()
+	}
+	orphans, err := ct.cm.Reset(ht)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cm.Reset(%d)", ht)
+	}
+	if err = ct.nm.Reset(ht); err != nil {
+		return nil, errors.Wrapf(err, "nm.Reset(%d)", ht)
+	}
+	if err = ct.restoreRoot(); err != nil {
+		return nil, errors.Wrapf(err, "restoreRoot()")
 	}
-	ct.cm.Reset(ht)
-	ct.nm.Reset(ht)
 	ct.tr.SetRoot(ct.Head().MerkleRoot)
-	return nil
+	if err := ct.flush(); err != nil {
+		return nil, errors.Wrapf(err, "flush()")
+	}
+	return orphans, ct.normalize()
+}
+
+// Prove returns a Proof of the name against the Merkle Hash of the Head commit.
+func (ct *ClaimTrie) Prove(name string) (*proof.Proof, error) {
+	name = ct.Params().NormalizeName(name, ct.Height())
+	return ct.tr.Prove(ct.Head().MerkleRoot, []byte(name))
+}
+
+// ProveClaim returns a Proof of the claim of id under the name against the
+// Merkle Hash of the Head commit.
+// Before the AllClaimsInMerkleForkHeight, only the best claim can be proved.
+func (ct *ClaimTrie) ProveClaim(name string, id claim.ID) (*proof.Proof, error) {
+	name = ct.Params().NormalizeName(name, ct.Height())
+	return ct.proveClaim(ct.nm.NodeAt(name, ct.Height()), ct.Head().MerkleRoot, id)
+}
+
+// proveClaim returns a Proof of the claim of id in the node n against the
+// root, which is the Merkle Hash at the height of the node.
+func (ct *ClaimTrie) proveClaim(n *claim.Node, root *chainhash.Hash, id claim.ID) (*proof.Proof, error) {
+	i := -1
+	for j, c := range n.ActiveClaims() {
+		if c.ID == id {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		return nil, errors.Wrapf(ErrClaimNotFound, "claim %s of %s", id, n.Name())
+	}
+	p, err := ct.tr.Prove(root, []byte(n.Name()))
+	if err != nil {
+		return nil, err
+	}
+	if n.Height() < ct.Params().AllClaimsInMerkleForkHeight {
+		if i != 0 {
+			return nil, errors.Wrapf(ErrClaimNotFound, "claim %s of %s isn't the best claim", id, n.Name())
+		}
+		return p, nil
+	}
+	p.Claim = &proof.Branch{Index: i, Hashes: claim.MerkleBranch(n.ClaimHashes(), i)}
+	return p, nil
 }
@@ -0,0 +1,103 @@
+package claimtrie
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/lbryio/claimtrie/cfg"
+	"github.com/lbryio/claimtrie/claim"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// openTestClaimTrie opens a ClaimTrie in dir with the regtest params.
+func openTestClaimTrie(t *testing.T, dir string) *ClaimTrie {
+	c := cfg.DefaultConfig()
+	c.DataDir = dir
+	c.Params = claim.RegTestParams
+	c.Logger = nil
+	ct, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ct
+}
+
+// TestReopen checks the nodes are loaded lazily after the ClaimTrie is
+// reopened, and the pending updates, such as the activations and the
+// expirations, still happen. One of the reopens has to build the schedule
+// and the index from all nodes, as a database written before they were kept.
+func TestReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claimtrie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ref := newTestClaimTrie(t)
+	ct := openTestClaimTrie(t, dir)
+	r := rand.New(rand.NewSource(1))
+	names := []string{"a", "ab", "abc", "b", "hello", "x"}
+	claims := map[string][]claim.OutPoint{}
+	seq := 0
+	for ht := claim.Height(1); ht <= 650; ht++ {
+		// The changes stop at the reopen building the schedule, so the
+		// expirations beyond have to be found in it.
+		for i := 0; ht <= 300 && i < r.Intn(3); i++ {
+			name := names[r.Intn(len(names))]
+			seq++
+			op := *claim.NewOutPoint(&chainhash.Hash{byte(seq), byte(seq >> 8)}, 0)
+			amt := claim.Amount(1 + r.Intn(100))
+			l := claims[name]
+			k := r.Intn(3)
+			for _, tr := range []*ClaimTrie{ref, ct} {
+				switch {
+				case len(l) == 0 || k == 0:
+					err = tr.AddClaim(name, op, amt, nil)
+				case k == 1:
+					err = tr.AddSupport(name, op, amt, claim.NewID(l[0]))
+				default:
+					err = tr.SpendClaim(name, l[0])
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			switch {
+			case len(l) == 0 || k == 0:
+				claims[name] = append(l, op)
+			case k == 2:
+				claims[name] = l[1:]
+			}
+		}
+		for _, tr := range []*ClaimTrie{ref, ct} {
+			if err := tr.Commit(ht); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if *ct.MerkleHash() != *ref.MerkleHash() {
+			t.Fatalf("root mismatch at %d", ht)
+		}
+		if ht%150 != 0 {
+			continue
+		}
+		if ht == 300 {
+			if err := ct.NodeMgr().DropSchedule(); err != nil {
+				t.Fatal(err)
+			}
+			if err := ct.flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ct.Close(); err != nil {
+			t.Fatal(err)
+		}
+		ct = openTestClaimTrie(t, dir)
+		if n := ct.NodeMgr().Size(); n != 0 {
+			t.Fatalf("%d nodes loaded on open at %d", n, ht)
+		}
+	}
+	ct.Close() // nolint : errchk
+}
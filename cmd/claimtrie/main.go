@@ -14,15 +14,19 @@ import (
 	"github.com/lbryio/claimtrie"
 	"github.com/lbryio/claimtrie/cfg"
 	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/resolve"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/pkg/errors"
-	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/urfave/cli"
 )
 
 var (
-	ct *claimtrie.ClaimTrie
+	ct     *claimtrie.ClaimTrie
+	conf   = cfg.DefaultConfig()
+	net    string
+	verify string
+	repair string
 )
 
 var (
@@ -36,6 +40,8 @@ var (
 	amt     claim.Amount
 	op      claim.OutPoint
 	id      claim.ID
+	hash    *chainhash.Hash
+	parent  *chainhash.Hash
 )
 
 var (
@@ -49,6 +55,59 @@ var (
 	flagValue    = cli.StringFlag{Name: "value, val", Value: "{\"I'm Node Value\"}", Usage: "Value", Destination: &value}
 	flagID       = cli.StringFlag{Name: "id", Usage: "Claim ID"}
 	flagOutPoint = cli.StringFlag{Name: "outpoint, op", Usage: "Outpoint. (HASH:INDEX)"}
+	flagPrefix   = cli.StringFlag{Name: "prefix", Usage: "Claim ID, or its prefix"}
+	flagStart    = cli.StringFlag{Name: "start", Usage: "First name of the range"}
+	flagEnd      = cli.StringFlag{Name: "end", Usage: "Name ending the range (exclusive)"}
+	flagNames    = cli.StringFlag{Name: "prefix", Usage: "Name prefix"}
+	flagFrom     = cli.Int64Flag{Name: "from", Usage: "Height to diff from"}
+	flagTo       = cli.Int64Flag{Name: "to", Usage: "Height to diff to (default: Head)"}
+	flagDepth    = cli.IntFlag{Name: "depth", Value: 100, Usage: "Number of latest commits to keep"}
+	flagUnpin    = cli.BoolFlag{Name: "unpin", Usage: "Unpin the commit"}
+	flagURL      = cli.StringFlag{Name: "url", Usage: "LBRY URL. (name#id, name:seq or name$rank)"}
+	flagHash     = cli.StringFlag{Name: "hash", Usage: "Block hash"}
+	flagParent   = cli.StringFlag{Name: "parent", Usage: "Parent block hash"}
+)
+
+var (
+	globalFlags = []cli.Flag{
+		cli.StringFlag{Name: "datadir", Value: conf.DataDir, Usage: "Data directory", Destination: &conf.DataDir},
+		cli.StringFlag{Name: "triedb", Usage: "Path of the trie database (default: DATADIR/trie.db)"},
+		cli.StringFlag{Name: "nodedb", Usage: "Path of the node database (default: DATADIR/nm.db)"},
+		cli.StringFlag{Name: "commitdb", Usage: "Path of the commit database (default: DATADIR/commit.db)"},
+		cli.StringFlag{Name: "csdb", Usage: "Path of the claim script database (default: DATADIR/cs.db)"},
+		cli.StringFlag{Name: "indexdb", Usage: "Path of the index database (default: DATADIR/idx.db)"},
+		cli.IntFlag{Name: "cache", Value: conf.CacheSize, Usage: "Block cache size of each database in MiB", Destination: &conf.CacheSize},
+		cli.IntFlag{Name: "writebuffer", Value: conf.WriteBuffer, Usage: "Write buffer size of each database in MiB", Destination: &conf.WriteBuffer},
+		cli.BoolTFlag{Name: "compression", Usage: "Compress the databases with Snappy", Destination: &conf.Compression},
+		cli.BoolFlag{Name: "inmemory", Usage: "Keep the databases in memory. Nothing is persisted", Destination: &conf.InMemory},
+		cli.StringFlag{Name: "net", Value: conf.Params.Name, Usage: "Network parameters (mainnet, testnet or regtest)", Destination: &net},
+		cli.StringFlag{Name: "verify", Value: "quick", Usage: "Check the databases on start (none, quick or full)", Destination: &verify},
+		cli.StringFlag{Name: "repair", Value: "none", Usage: "Repair the databases if the check fails (none, trie or truncate)", Destination: &repair},
+		cli.IntFlag{Name: "nodecache", Value: conf.NodeCache, Usage: "Memory bound of the cached nodes in MiB (0: unbounded)", Destination: &conf.NodeCache},
+		cli.IntFlag{Name: "snapinterval", Value: conf.SnapshotInterval, Usage: "Number of blocks between the snapshots of a node (0: disabled)", Destination: &conf.SnapshotInterval},
+		cli.IntFlag{Name: "snapchanges", Value: conf.SnapshotChanges, Usage: "Number of changes between the snapshots of a node (0: disabled)", Destination: &conf.SnapshotChanges},
+		cli.IntFlag{Name: "prunedepth", Value: conf.PruneDepth, Usage: "Number of latest commits whose tries are kept (0: all)", Destination: &conf.PruneDepth},
+		cli.IntFlag{Name: "pruneinterval", Value: conf.PruneInterval, Usage: "Number of blocks between the prunings of the trie database", Destination: &conf.PruneInterval},
+		cli.IntFlag{Name: "hashworkers", Value: conf.HashWorkers, Usage: "Number of goroutines hashing the trie (0: one per CPU)", Destination: &conf.HashWorkers},
+		cli.IntFlag{Name: "undodepth", Value: conf.UndoDepth, Usage: "Number of recent blocks which can be reset with undo records", Destination: &conf.UndoDepth},
+	}
+	dbFlags = map[string]cfg.Index{
+		"triedb":   cfg.TrieDB,
+		"nodedb":   cfg.NodeDB,
+		"commitdb": cfg.CommitDB,
+		"indexdb":  cfg.IndexDB,
+		"csdb":     cfg.ClaimScriptDB,
+	}
+	verifyModes = map[string]cfg.VerifyMode{
+		"none":  cfg.VerifyNone,
+		"quick": cfg.VerifyQuick,
+		"full":  cfg.VerifyFull,
+	}
+	repairModes = map[string]cfg.RepairMode{
+		"none":     cfg.RepairNone,
+		"trie":     cfg.RepairRebuildTrie,
+		"truncate": cfg.RepairTruncate,
+	}
 )
 
 var (
@@ -62,6 +121,8 @@ func main() {
 	app.Usage = "A CLI tool for LBRY ClaimTrie"
 	app.Version = "0.0.1"
 	app.Action = cli.ShowAppHelp
+	app.Flags = globalFlags
+	app.Before = openClaimTrie
 	app.Commands = []cli.Command{
 		{
 			Name:    "add-claim",
@@ -103,6 +164,14 @@ func main() {
 			Action:  cmdSpendSupport,
 			Flags:   []cli.Flag{flagName, flagOutPoint},
 		},
+		{
+			Name:    "spend",
+			Aliases: []string{"sp"},
+			Usage:   "Spend a Claim or Support by its outpoint.",
+			Before:  parseArgs,
+			Action:  cmdSpend,
+			Flags:   []cli.Flag{flagOutPoint},
+		},
 		{
 			Name:    "show",
 			Aliases: []string{"s"},
@@ -111,6 +180,30 @@ func main() {
 			Action:  cmdShow,
 			Flags:   []cli.Flag{flagAll, flagName, flagHeight, flagDump},
 		},
+		{
+			Name:    "resolve",
+			Aliases: []string{"rs"},
+			Usage:   "Resolve a name, a claim ID (or its prefix), or a LBRY URL.",
+			Before:  parseArgs,
+			Action:  cmdResolve,
+			Flags:   []cli.Flag{flagName, flagPrefix, flagURL, flagHeight},
+		},
+		{
+			Name:    "names",
+			Aliases: []string{"ns"},
+			Usage:   "List the names in order, in a range or with a prefix.",
+			Before:  parseArgs,
+			Action:  cmdNames,
+			Flags:   []cli.Flag{flagNames, flagStart, flagEnd, flagHeight},
+		},
+		{
+			Name:    "diff",
+			Aliases: []string{"df"},
+			Usage:   "List the names added (+), removed (-) or changed (~) between two commits.",
+			Before:  parseArgs,
+			Action:  cmdDiff,
+			Flags:   []cli.Flag{flagFrom, flagTo},
+		},
 		{
 			Name:    "merkle",
 			Aliases: []string{"m"},
@@ -124,15 +217,15 @@ func main() {
 			Usage:   "Commit the current changes to database.",
 			Before:  parseArgs,
 			Action:  cmdCommit,
-			Flags:   []cli.Flag{flagHeight},
+			Flags:   []cli.Flag{flagHeight, flagHash, flagParent},
 		},
 		{
 			Name:    "reset",
 			Aliases: []string{"r"},
-			Usage:   "Reset the Head commit and a specified commit (by Height).",
+			Usage:   "Reset the Head commit and a specified commit (by Height or block hash).",
 			Before:  parseArgs,
 			Action:  cmdReset,
-			Flags:   []cli.Flag{flagHeight},
+			Flags:   []cli.Flag{flagHeight, flagHash},
 		},
 		{
 			Name:    "log",
@@ -141,6 +234,22 @@ func main() {
 			Before:  parseArgs,
 			Action:  cmdLog,
 		},
+		{
+			Name:    "prune",
+			Aliases: []string{"pr"},
+			Usage:   "Prune the tries of old commits, except the pinned ones.",
+			Before:  parseArgs,
+			Action:  cmdPrune,
+			Flags:   []cli.Flag{flagDepth},
+		},
+		{
+			Name:    "pin",
+			Aliases: []string{"p"},
+			Usage:   "Pin a commit to keep its trie from pruning, or list the pinned ones.",
+			Before:  parseArgs,
+			Action:  cmdPin,
+			Flags:   []cli.Flag{flagHeight, flagUnpin},
+		},
 		{
 			Name:    "ipmort",
 			Aliases: []string{"i"},
@@ -165,15 +274,38 @@ func main() {
 		},
 	}
 
-	var err error
-	if ct, err = claimtrie.New(); err != nil {
-		log.Fatalf("can'y create ClaimTrie, err: %s", err)
-	}
 	if err := app.Run(os.Args); err != nil {
 		fmt.Printf("error: %s\n", err)
 	}
 }
 
+func openClaimTrie(c *cli.Context) error {
+	if ct != nil {
+		return nil
+	}
+	params, ok := claim.Networks[net]
+	if !ok {
+		return fmt.Errorf("unknown network: %s", net)
+	}
+	conf.Params = params
+	if conf.Verify, ok = verifyModes[verify]; !ok {
+		return fmt.Errorf("unknown verify mode: %s", verify)
+	}
+	if conf.Repair, ok = repairModes[repair]; !ok {
+		return fmt.Errorf("unknown repair mode: %s", repair)
+	}
+	for flag, idx := range dbFlags {
+		if c.IsSet(flag) {
+			conf.Paths[idx] = c.String(flag)
+		}
+	}
+	var err error
+	if ct, err = claimtrie.New(conf); err != nil {
+		log.Fatalf("can't create ClaimTrie, err: %s", err)
+	}
+	return nil
+}
+
 func cmdAddClaim(c *cli.Context) error {
 	return ct.AddClaim(name, op, amt, []byte(value))
 }
@@ -200,6 +332,10 @@ func cmdSpendSupport(c *cli.Context) error {
 	return ct.SpendSupport(name, op)
 }
 
+func cmdSpend(c *cli.Context) error {
+	return ct.Spend(op)
+}
+
 func cmdShow(c *cli.Context) error {
 	fmt.Printf("\n<ClaimTrie Height %d >\n\n", ct.Height())
 	if all {
@@ -211,36 +347,151 @@ func cmdShow(c *cli.Context) error {
 	return ct.NodeMgr().Show(name, height, dump)
 }
 
+// querier answers the queries at the Head, or at an earlier height.
+type querier interface {
+	ResolveName(name string) (*claimtrie.Result, error)
+	ResolvePrefix(prefix string) (*claimtrie.Result, error)
+	ResolveURL(url string) (*resolve.Result, error)
+	WalkNames(start, end string, visit claimtrie.NameVisit) error
+	WalkPrefix(prefix string, visit claimtrie.NameVisit) error
+}
+
+// queryAt returns the ClaimTrie, or its View at the height if specified.
+func queryAt(c *cli.Context) (querier, error) {
+	if !c.IsSet("height") {
+		return ct, nil
+	}
+	return ct.At(height)
+}
+
+func cmdResolve(c *cli.Context) error {
+	q, err := queryAt(c)
+	if err != nil {
+		return err
+	}
+	if c.IsSet("url") {
+		res, err := q.ResolveURL(c.String("url"))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("[%s] %s active: %t, rank: %d, best: %t, tookover: %d\n",
+			res.Name, &res.Claim, res.Active, res.Rank, res.Best, res.Tookover)
+		return nil
+	}
+	var res *claimtrie.Result
+	if c.IsSet("prefix") {
+		res, err = q.ResolvePrefix(c.String("prefix"))
+	} else {
+		res, err = q.ResolveName(name)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[%s] %s best: %t, tookover: %d\n", res.Name, res.Claim, res.Best, res.Tookover)
+	return nil
+}
+
+func cmdNames(c *cli.Context) error {
+	q, err := queryAt(c)
+	if err != nil {
+		return err
+	}
+	visit := func(name string) bool {
+		fmt.Printf("%s\n", name)
+		return false
+	}
+	if c.IsSet("prefix") {
+		return q.WalkPrefix(c.String("prefix"), visit)
+	}
+	return q.WalkNames(c.String("start"), c.String("end"), visit)
+}
+
+func cmdDiff(c *cli.Context) error {
+	to := claim.Height(c.Int64("to"))
+	if !c.IsSet("to") {
+		to = ct.Height()
+	}
+	return ct.Diff(claim.Height(c.Int64("from")), to, func(name string, from, to *chainhash.Hash) bool {
+		switch {
+		case from == nil:
+			fmt.Printf("+ %s\n", name)
+		case to == nil:
+			fmt.Printf("- %s\n", name)
+		default:
+			fmt.Printf("~ %s\n", name)
+		}
+		return false
+	})
+}
+
 func cmdMerkle(c *cli.Context) error {
 	fmt.Printf("%s at %d\n", ct.MerkleHash(), ct.Height())
 	return nil
 }
 
 func cmdCommit(c *cli.Context) error {
+	if c.IsSet("hash") {
+		return ct.CommitBlock(hash, parent)
+	}
 	if !c.IsSet("height") {
 		height = ct.Height() + 1
 	}
-	ct.Commit(height)
-	return nil
+	return ct.Commit(height)
 }
 
 func cmdReset(c *cli.Context) error {
-	return ct.Reset(height)
+	if !c.IsSet("hash") {
+		return ct.Reset(height)
+	}
+	orphans, err := ct.ResetBlock(hash)
+	for _, o := range orphans {
+		fmt.Printf("orphaned %s at %d\n", o.Meta.Hash, o.Meta.Height)
+	}
+	return err
 }
 
 func cmdLog(c *cli.Context) error {
-	visit := func(c *claimtrie.Commit) {
-		fmt.Printf("%s at %d\n", c.MerkleRoot, c.Meta.Height)
+	visit := func(c *claimtrie.Commit) bool {
+		fmt.Printf("%s at %d", c.MerkleRoot, c.Meta.Height)
+		if c.Meta.Hash != (chainhash.Hash{}) {
+			fmt.Printf(" block %s", c.Meta.Hash)
+		}
+		fmt.Println()
+		return false
 	}
-	ct.CommitMgr().Log(ct.Height(), visit)
+	return ct.CommitMgr().Log(ct.Height(), visit)
+}
+
+func cmdPrune(c *cli.Context) error {
+	n, err := ct.Prune(c.Int("depth"))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d nodes pruned\n", n)
 	return nil
 }
 
+func cmdPin(c *cli.Context) error {
+	switch {
+	case !c.IsSet("height"):
+		pins, err := ct.Pins()
+		if err != nil {
+			return err
+		}
+		for _, ht := range pins {
+			fmt.Println(ht)
+		}
+		return nil
+	case c.Bool("unpin"):
+		return ct.Unpin(height)
+	}
+	return ct.Pin(height)
+}
+
 func cmdImport(c *cli.Context) error {
-	path := cfg.DefaultConfig(cfg.ClaimScriptDB)
-	db, err := leveldb.OpenFile(path, nil)
+	db, err := conf.Open(cfg.ClaimScriptDB)
 	if err != nil {
-		return errors.Wrapf(err, "path %s", path)
+		return err
 	}
 	defer db.Close()
 	if err = claimtrie.Load(db, ct, height, verbose, chk); err != nil {
@@ -250,13 +501,16 @@ func cmdImport(c *cli.Context) error {
 }
 
 func cmdErase(c *cli.Context) error {
-	if err := os.RemoveAll(cfg.DefaultConfig(cfg.CommitDB)); err != nil {
+	if err := os.RemoveAll(conf.Path(cfg.CommitDB)); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(conf.Path(cfg.NodeDB)); err != nil {
 		return err
 	}
-	if err := os.RemoveAll(cfg.DefaultConfig(cfg.NodeDB)); err != nil {
+	if err := os.RemoveAll(conf.Path(cfg.TrieDB)); err != nil {
 		return err
 	}
-	if err := os.RemoveAll(cfg.DefaultConfig(cfg.TrieDB)); err != nil {
+	if err := os.RemoveAll(conf.Path(cfg.IndexDB)); err != nil {
 		return err
 	}
 	fmt.Printf("Databses erased. Exiting...\n")
@@ -292,7 +546,7 @@ func cmdShell(app *cli.App) {
 			}
 			break
 		}
-		err = app.Run(append(os.Args[1:], strings.Split(text, " ")...))
+		err = app.Run(append([]string{app.Name}, strings.Split(text, " ")...))
 		if err != nil {
 			fmt.Printf("error: %s\n", err)
 		}
@@ -307,6 +561,7 @@ func parseArgs(c *cli.Context) error {
 		parseAmt,
 		parseHeight,
 		parseID,
+		parseHash,
 	}
 	for _, p := range parsers {
 		if err := p(c); err != nil {
@@ -357,6 +612,22 @@ func parseAmt(c *cli.Context) error {
 	return nil
 }
 
+func parseHash(c *cli.Context) error {
+	var err error
+	hash, parent = &chainhash.Hash{}, &chainhash.Hash{}
+	if c.IsSet("hash") {
+		if hash, err = chainhash.NewHashFromStr(c.String("hash")); err != nil {
+			return err
+		}
+	}
+	if c.IsSet("parent") {
+		if parent, err = chainhash.NewHashFromStr(c.String("parent")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func parseID(c *cli.Context) error {
 	if !c.IsSet("id") {
 		return nil
@@ -2,23 +2,58 @@ package claimtrie
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/gob"
 	"sync"
 
 	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/storage"
 	"github.com/lbryio/claimtrie/trie"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/pkg/errors"
-	"github.com/syndtr/goleveldb/leveldb"
 )
 
-// CommitVisit ...
-type CommitVisit func(c *Commit)
+// Keys of the commit database.
+//
+// Each commit is stored under its own record keyed by its height, and the
+// commits with block hashes are indexed by the hash. The Head only points to
+// the height of the latest record. The pinned heights are kept under their
+// own keys.
+var (
+	headKey   = []byte("Head")
+	paramsKey = []byte("Params")
+	legacyKey = []byte("CommitMgr")
+)
+
+func commitKey(ht claim.Height) []byte {
+	key := make([]byte, 5)
+	key[0] = 'c'
+	binary.BigEndian.PutUint32(key[1:], uint32(ht))
+	return key
+}
+
+func blockKey(hash *chainhash.Hash) []byte {
+	return append([]byte{'b'}, hash[:]...)
+}
+
+func pinKey(ht claim.Height) []byte {
+	key := commitKey(ht)
+	key[0] = 'p'
+	return key
+}
+
+// CommitVisit visits a commit. If it returns true, the iteration ends immediately.
+type CommitVisit func(c *Commit) (stop bool)
 
 // CommitMeta represent the meta associated with each commit.
+//
+// Hash is the hash of the committed block, and Parent is the Hash of the
+// commit it's based on. Both are zero for commits made without block hashes.
 type CommitMeta struct {
 	Height claim.Height
+	Hash   chainhash.Hash
+	Parent chainhash.Hash
 }
 
 func newCommit(head *Commit, meta CommitMeta, h *chainhash.Hash) *Commit {
@@ -34,24 +69,27 @@ type Commit struct {
 	Meta       CommitMeta
 }
 
+// record is the persisted form of a commit, which links to the height of the
+// previous commit.
+type record struct {
+	Commit *Commit
+	Prev   claim.Height
+}
+
+// genesis is the commit at height 0, which is implied and never stored.
+var genesis = newCommit(nil, CommitMeta{}, trie.EmptyTrieHash)
+
 // CommitMgr ...
 type CommitMgr struct {
 	sync.RWMutex
 
-	db      *leveldb.DB
-	commits []*Commit
-	head    *Commit
+	db   storage.DB
+	head *Commit
 }
 
 // NewCommitMgr ...
-func NewCommitMgr(db *leveldb.DB) *CommitMgr {
-	head := newCommit(nil, CommitMeta{0}, trie.EmptyTrieHash)
-	cm := CommitMgr{
-		db:   db,
-		head: head,
-	}
-	cm.commits = append(cm.commits, head)
-	return &cm
+func NewCommitMgr(db storage.DB) *CommitMgr {
+	return &CommitMgr{db: db, head: genesis}
 }
 
 // Head ...
@@ -61,90 +99,294 @@ func (cm *CommitMgr) Head() *Commit {
 	return cm.head
 }
 
-// Commit ...
-func (cm *CommitMgr) Commit(ht claim.Height, merkle *chainhash.Hash) {
-	if ht == 0 {
-		return
+// Commit appends a commit with the meta on top of the Head, and writes it
+// to the database.
+// It returns ErrParentMismatch if the meta is not based on the Head.
+func (cm *CommitMgr) Commit(meta CommitMeta, merkle *chainhash.Hash) error {
+	if meta.Height == 0 {
+		return nil
+	}
+	if err := cm.CheckParent(meta); err != nil {
+		return err
 	}
 	cm.Lock()
 	defer cm.Unlock()
-	c := newCommit(cm.head, CommitMeta{ht}, merkle)
-	cm.commits = append(cm.commits, c)
-	cm.head = c
+	c := newCommit(cm.head, meta, merkle)
+	if err := cm.put(&record{Commit: c, Prev: cm.head.Meta.Height}); err != nil {
+		return err
+	}
+	return cm.setHead(c)
+}
+
+// CheckParent returns ErrParentMismatch if the meta has a block hash, but its
+// Parent is not the block hash of the Head.
+// The check is skipped if the Head was made without block hash.
+func (cm *CommitMgr) CheckParent(meta CommitMeta) error {
+	cm.RLock()
+	defer cm.RUnlock()
+	head := cm.head.Meta
+	if meta.Hash == (chainhash.Hash{}) || head.Hash == (chainhash.Hash{}) {
+		return nil
+	}
+	if meta.Parent != head.Hash {
+		return errors.Wrapf(ErrParentMismatch, "block %s has parent %s, head %d is %s",
+			meta.Hash, meta.Parent, head.Height, head.Hash)
+	}
+	return nil
+}
+
+// Find returns the commit of the block hash.
+// It returns ErrUnknownBlock if the block hash isn't found.
+func (cm *CommitMgr) Find(hash *chainhash.Hash) (*Commit, error) {
+	data, err := cm.db.Get(blockKey(hash))
+	if err == storage.ErrNotFound {
+		return nil, errors.Wrapf(ErrUnknownBlock, "block %s", hash)
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "db.Get(%s)", hash)
+	}
+	c, _, err := cm.get(claim.Height(binary.BigEndian.Uint32(data)))
+	return c, err
+}
+
+// Reset resets the Head to the latest commit at or below height ht, and
+// returns the commits removed, from the highest one.
+// If that commit is below ht, a commit at ht with the same MerkleRoot is made.
+func (cm *CommitMgr) Reset(ht claim.Height) ([]*Commit, error) {
+	orphans, err := cm.reset(ht)
+	if err != nil {
+		return nil, err
+	}
+	if head := cm.Head(); head.Meta.Height != ht {
+		if err = cm.Commit(CommitMeta{Height: ht}, head.MerkleRoot); err != nil {
+			return nil, err
+		}
+	}
+	return orphans, nil
 }
 
-// Reset ...
-func (cm *CommitMgr) Reset(ht claim.Height) {
+func (cm *CommitMgr) reset(ht claim.Height) ([]*Commit, error) {
 	cm.Lock()
 	defer cm.Unlock()
-	for i := len(cm.commits) - 1; i >= 0; i-- {
-		c := cm.commits[i]
-		if c.Meta.Height <= ht {
-			cm.head = c
-			cm.commits = cm.commits[:i+1]
-			break
+	var orphans []*Commit
+	c, prev, err := cm.get(cm.head.Meta.Height)
+	for ; err == nil && c.Meta.Height > ht; c, prev, err = cm.get(prev) {
+		if err = cm.remove(c); err != nil {
+			return nil, err
 		}
+		orphans = append(orphans, c)
 	}
-	if cm.head.Meta.Height == ht {
-		return
+	if err != nil {
+		return nil, err
 	}
-	cm.Commit(ht, cm.head.MerkleRoot)
+	return orphans, cm.setHead(c)
 }
 
-// Save ...
-func (cm *CommitMgr) Save() error {
+// Load loads the Head from the database.
+// The commits saved as a whole by earlier versions are converted to records.
+func (cm *CommitMgr) Load() error {
 	cm.Lock()
 	defer cm.Unlock()
-	exported := struct {
-		Commits []*Commit
-		Head    *Commit
-	}{
-		Commits: cm.commits,
-		Head:    cm.head,
-	}
-
-	buf := bytes.NewBuffer(nil)
-	if err := gob.NewEncoder(buf).Encode(exported); err != nil {
-		return errors.Wrapf(err, "gob.Encode()", err)
+	data, err := cm.db.Get(headKey)
+	if err == storage.ErrNotFound {
+		return cm.convert()
+	} else if err != nil {
+		return errors.Wrapf(err, "db.Get(Head)")
 	}
-	if err := cm.db.Put([]byte("CommitMgr"), buf.Bytes(), nil); err != nil {
-		return errors.Wrapf(err, "db.Put(CommitMgr)")
+	c, _, err := cm.get(claim.Height(binary.BigEndian.Uint32(data)))
+	if err != nil {
+		return err
 	}
+	cm.head = c
 	return nil
 }
 
-// Load ...
-func (cm *CommitMgr) Load() error {
-	cm.Lock()
-	defer cm.Unlock()
+func (cm *CommitMgr) convert() error {
 	exported := struct {
 		Commits []*Commit
 		Head    *Commit
 	}{}
 
-	data, err := cm.db.Get([]byte("CommitMgr"), nil)
-	if err == leveldb.ErrNotFound {
+	data, err := cm.db.Get(legacyKey)
+	if err == storage.ErrNotFound {
 		return nil
 	} else if err != nil {
 		return errors.Wrapf(err, "db.Get(CommitMgr)")
 	}
 	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&exported); err != nil {
-		return errors.Wrapf(err, "gob.Encode()", err)
+		return errors.Wrapf(err, "gob.Decode()")
+	}
+	prev := claim.Height(0)
+	for _, c := range exported.Commits {
+		if c.Meta.Height == 0 {
+			continue
+		}
+		if err = cm.put(&record{Commit: c, Prev: prev}); err != nil {
+			return err
+		}
+		prev = c.Meta.Height
+	}
+	if exported.Head != nil {
+		if err = cm.setHead(exported.Head); err != nil {
+			return err
+		}
+	}
+	return errors.Wrapf(cm.db.Delete(legacyKey), "db.Delete(CommitMgr)")
+}
+
+// paramsID identifies the Params a database is built with. Unlike the whole
+// Params, it stays the same as fields are added to them, so a change of the
+// consensus heights has to bump the Version. It decodes from the
+// whole Params stored by the earlier versions too, as gob matches the fields
+// by name.
+type paramsID struct {
+	Name    string
+	Version int
+}
+
+// CheckParams stores the identity of the params p to the database if it has
+// none. Otherwise, it returns ErrParamsMismatch if the stored one has another
+// Name or Version.
+func (cm *CommitMgr) CheckParams(p claim.Params) error {
+	cm.Lock()
+	defer cm.Unlock()
+	id := paramsID{Name: p.Name, Version: p.Version}
+	data, err := cm.db.Get(paramsKey)
+	if err == storage.ErrNotFound {
+		buf := bytes.NewBuffer(nil)
+		if err = gob.NewEncoder(buf).Encode(id); err != nil {
+			return errors.Wrapf(err, "gob.Encode()")
+		}
+		return errors.Wrapf(cm.db.Put(paramsKey, buf.Bytes()), "db.Put(Params)")
+	} else if err != nil {
+		return errors.Wrapf(err, "db.Get(Params)")
+	}
+	var stored paramsID
+	if err = gob.NewDecoder(bytes.NewBuffer(data)).Decode(&stored); err != nil {
+		return errors.Wrapf(err, "gob.Decode()")
+	}
+	if stored != id {
+		return errors.Wrapf(ErrParamsMismatch, "database: %s v%d, want: %s v%d", stored.Name, stored.Version, id.Name, id.Version)
 	}
-	cm.commits = exported.Commits
-	cm.head = exported.Head
 	return nil
 }
 
-// Log ...
-func (cm *CommitMgr) Log(ht claim.Height, visit CommitVisit) {
+// Log visits the commits at or below height ht, from the highest one.
+// The commits are read from the database as the visit goes.
+func (cm *CommitMgr) Log(ht claim.Height, visit CommitVisit) error {
+	c, prev, err := cm.get(cm.Head().Meta.Height)
+	for ; err == nil; c, prev, err = cm.get(prev) {
+		if c.Meta.Height <= ht && visit(c) {
+			return nil
+		}
+		if c.Meta.Height == 0 {
+			return nil
+		}
+	}
+	return err
+}
+
+// At returns the latest commit at or below height ht, or ErrCommitNotFound if
+// there is none.
+func (cm *CommitMgr) At(ht claim.Height) (*Commit, error) {
+	if head := cm.Head(); head.Meta.Height <= ht {
+		return head, nil
+	}
+	// The heights skipped by a commit have no record of their own.
+	c, _, err := cm.get(ht)
+	if err == nil {
+		return c, nil
+	} else if errors.Cause(err) != storage.ErrNotFound {
+		return nil, err
+	}
+	err = cm.Log(ht, func(v *Commit) bool {
+		c = v
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, errors.Wrapf(ErrCommitNotFound, "at or below %d", ht)
+	}
+	return c, nil
+}
+
+// Pin pins the commit at height ht, so its trie is kept by the pruning.
+func (cm *CommitMgr) Pin(ht claim.Height) error {
+	cm.Lock()
+	defer cm.Unlock()
+	return errors.Wrapf(cm.db.Put(pinKey(ht), nil), "db.Put(pin %d)", ht)
+}
+
+// Unpin unpins the commit at height ht.
+func (cm *CommitMgr) Unpin(ht claim.Height) error {
+	cm.Lock()
+	defer cm.Unlock()
+	return errors.Wrapf(cm.db.Delete(pinKey(ht)), "db.Delete(pin %d)", ht)
+}
+
+// Pins returns the pinned heights, from the lowest one.
+func (cm *CommitMgr) Pins() ([]claim.Height, error) {
 	cm.RLock()
 	defer cm.RUnlock()
-	for i := len(cm.commits) - 1; i >= 0; i-- {
-		c := cm.commits[i]
-		if c.Meta.Height > ht {
-			continue
+	var pins []claim.Height
+	iter := cm.db.NewIterator([]byte{'p'})
+	defer iter.Release()
+	for iter.Next() {
+		if key := iter.Key(); len(key) == 5 {
+			pins = append(pins, claim.Height(binary.BigEndian.Uint32(key[1:])))
 		}
-		visit(c)
 	}
+	return pins, errors.Wrapf(iter.Error(), "iterate pins")
+}
+
+// get returns the commit at height ht, and the height of the previous one.
+func (cm *CommitMgr) get(ht claim.Height) (*Commit, claim.Height, error) {
+	if ht == 0 {
+		return genesis, -1, nil
+	}
+	data, err := cm.db.Get(commitKey(ht))
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "db.Get(commit %d)", ht)
+	}
+	var r record
+	if err = gob.NewDecoder(bytes.NewBuffer(data)).Decode(&r); err != nil {
+		return nil, 0, errors.Wrapf(err, "gob.Decode()")
+	}
+	return r.Commit, r.Prev, nil
+}
+
+func (cm *CommitMgr) put(r *record) error {
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(r); err != nil {
+		return errors.Wrapf(err, "gob.Encode()")
+	}
+	key := commitKey(r.Commit.Meta.Height)
+	if err := cm.db.Put(key, buf.Bytes()); err != nil {
+		return errors.Wrapf(err, "db.Put(commit %d)", r.Commit.Meta.Height)
+	}
+	if hash := r.Commit.Meta.Hash; hash != (chainhash.Hash{}) {
+		return errors.Wrapf(cm.db.Put(blockKey(&hash), key[1:]), "db.Put(%s)", hash)
+	}
+	return nil
+}
+
+func (cm *CommitMgr) remove(c *Commit) error {
+	if err := cm.db.Delete(commitKey(c.Meta.Height)); err != nil {
+		return errors.Wrapf(err, "db.Delete(commit %d)", c.Meta.Height)
+	}
+	if hash := c.Meta.Hash; hash != (chainhash.Hash{}) {
+		return errors.Wrapf(cm.db.Delete(blockKey(&hash)), "db.Delete(%s)", hash)
+	}
+	return nil
+}
+
+func (cm *CommitMgr) setHead(c *Commit) error {
+	val := make([]byte, 4)
+	binary.BigEndian.PutUint32(val, uint32(c.Meta.Height))
+	if err := cm.db.Put(headKey, val); err != nil {
+		return errors.Wrapf(err, "db.Put(Head)")
+	}
+	cm.head = c
+	return nil
 }
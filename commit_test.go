@@ -0,0 +1,80 @@
+package claimtrie
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/storage"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/pkg/errors"
+)
+
+func TestCheckParams(t *testing.T) {
+	cm := NewCommitMgr(storage.NewMemDB())
+	if err := cm.CheckParams(claim.RegTestParams); err != nil {
+		t.Fatal(err)
+	}
+	// Only the Name and the Version are checked, which is why the Version has
+	// to be bumped along with the heights.
+	changed := claim.RegTestParams
+	changed.AllClaimsInMerkleForkHeight++
+	if err := cm.CheckParams(changed); err != nil {
+		t.Errorf("params of the same version: %s", err)
+	}
+	bumped := claim.RegTestParams
+	bumped.Version++
+	for _, p := range []claim.Params{claim.MainNetParams, bumped} {
+		if err := cm.CheckParams(p); errors.Cause(err) != ErrParamsMismatch {
+			t.Errorf("%s v%d: %v", p.Name, p.Version, err)
+		}
+	}
+}
+
+func TestCheckParamsLegacy(t *testing.T) {
+	// The whole Params were stored, before some of the fields were added.
+	type legacyParams struct {
+		Name                        string
+		MaxActiveDelay              claim.Height
+		OriginalClaimExpirationTime claim.Height
+	}
+	db := storage.NewMemDB()
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(legacyParams{Name: "regtest", MaxActiveDelay: 4032}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(paramsKey, buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	cm := NewCommitMgr(db)
+	if err := cm.CheckParams(claim.RegTestParams); err != nil {
+		t.Errorf("legacy params: %s", err)
+	}
+	if err := cm.CheckParams(claim.MainNetParams); errors.Cause(err) != ErrParamsMismatch {
+		t.Errorf("legacy params of another network: %v", err)
+	}
+}
+
+func TestCommitAt(t *testing.T) {
+	db := storage.NewMemDB()
+	cm := NewCommitMgr(db)
+	for _, ht := range []claim.Height{2, 5} {
+		if err := cm.Commit(CommitMeta{Height: ht}, &chainhash.Hash{byte(ht)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Height 3 is skipped by the commit at 5, so it's found in the log.
+	for ht, want := range map[claim.Height]claim.Height{0: 0, 2: 2, 3: 2, 5: 5, 9: 5} {
+		if c, err := cm.At(ht); err != nil || c.Meta.Height != want {
+			t.Errorf("At(%d): %v, %v, want %d", ht, c, err, want)
+		}
+	}
+	if err := db.Put(commitKey(2), []byte("corrupt")); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := cm.At(2); err == nil {
+		t.Errorf("At(2) of a corrupt record: %v", c)
+	}
+}
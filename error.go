@@ -1,8 +1,35 @@
 package claimtrie
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/lbryio/claimtrie/claim"
+)
 
 var (
 	// ErrInvalidHeight is returned when the height is invalid.
 	ErrInvalidHeight = fmt.Errorf("invalid height")
+
+	// ErrParamsMismatch is returned when the database was built with different network parameters.
+	ErrParamsMismatch = fmt.Errorf("params mismatch")
+
+	// ErrInconsistent is returned when the databases are inconsistent with each other.
+	ErrInconsistent = fmt.Errorf("inconsistent databases")
+
+	// ErrParentMismatch is returned when a block is committed on top of a Head
+	// other than its parent.
+	ErrParentMismatch = fmt.Errorf("parent mismatch")
+
+	// ErrCommitNotFound is returned when no commit is found at a height.
+	ErrCommitNotFound = fmt.Errorf("commit not found")
+
+	// ErrUnknownBlock is returned when the block hash isn't found in the commits.
+	ErrUnknownBlock = fmt.Errorf("unknown block")
+
+	// ErrClaimNotFound is returned when the claim isn't found, or can't be proved.
+	// It's claim.ErrClaimNotFound, which the resolve package returns as well.
+	ErrClaimNotFound = claim.ErrClaimNotFound
+
+	// ErrAmbiguousID is returned when a claim ID prefix matches more than one claim.
+	ErrAmbiguousID = fmt.Errorf("ambiguous claim ID")
 )
@@ -9,13 +9,13 @@ import (
 
 	"github.com/lbryio/claimtrie/change"
 	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/storage"
 
 	"github.com/pkg/errors"
-	"github.com/syndtr/goleveldb/leveldb"
 )
 
 // Load ...
-func Load(db *leveldb.DB, ct *ClaimTrie, ht claim.Height, verbose, chk bool) error {
+func Load(db storage.DB, ct *ClaimTrie, ht claim.Height, verbose, chk bool) error {
 	for i := ct.Height() + 1; i <= ht; i++ {
 		blk, err := getBlock(db, i)
 		if err != nil {
@@ -24,13 +24,17 @@ func Load(db *leveldb.DB, ct *ClaimTrie, ht claim.Height, verbose, chk bool) err
 		if blk == nil {
 			continue
 		}
-		ct.Commit(i - 1)
+		if err = ct.Commit(i - 1); err != nil {
+			return errors.Wrapf(err, "ct.Commit(%d)", i-1)
+		}
 		for _, chg := range blk.Changes {
 			if err = apply(ct, chg, verbose); err != nil {
 				return errors.Wrapf(err, "apply(%s)", chg)
 			}
 		}
-		ct.Commit(i)
+		if err = ct.Commit(i); err != nil {
+			return errors.Wrapf(err, "ct.Commit(%d)", i)
+		}
 
 		if !chk {
 			continue
@@ -39,14 +43,13 @@ func Load(db *leveldb.DB, ct *ClaimTrie, ht claim.Height, verbose, chk bool) err
 			return fmt.Errorf("blk %d hash: got %s, want %s", i, *hash, blk.Hash)
 		}
 	}
-	ct.Commit(ht)
-	return nil
+	return errors.Wrapf(ct.Commit(ht), "ct.Commit(%d)", ht)
 }
 
-func getBlock(db *leveldb.DB, ht claim.Height) (*change.Block, error) {
+func getBlock(db storage.DB, ht claim.Height) (*change.Block, error) {
 	key := strconv.Itoa(int(ht))
-	data, err := db.Get([]byte(key), nil)
-	if err == leveldb.ErrNotFound {
+	data, err := db.Get([]byte(key))
+	if err == storage.ErrNotFound {
 		return nil, nil
 	} else if err != nil {
 		return nil, errors.Wrapf(err, "db.Get(%s)", key)
@@ -0,0 +1,185 @@
+package nodemgr
+
+import (
+	"container/list"
+
+	"github.com/lbryio/claimtrie/claim"
+)
+
+// Estimated memory footprints, in bytes, used to bound the cache.
+const (
+	nodeOverhead  = 256 // claim.Node, its cache entry and list element.
+	claimOverhead = 160 // claim.Claim and the reference to it.
+)
+
+// CacheStats holds the statistics of the node cache.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+
+	// Nodes is the number of cached nodes, and Size is their estimated
+	// memory footprint in bytes.
+	Nodes int
+	Size  int
+}
+
+// cache is a LRU cache of nodes, bounded by the estimated memory footprint.
+// It's not synchronized, and the cachemu has to be held by the caller.
+type cache struct {
+	max   int // 0 means unbounded.
+	ll    *list.List
+	items map[string]*list.Element
+	stats CacheStats
+}
+
+type item struct {
+	n    *claim.Node
+	size int
+}
+
+func newCache() *cache {
+	return &cache{ll: list.New(), items: map[string]*list.Element{}}
+}
+
+// sizeOf estimates the memory footprint of the node.
+func sizeOf(n *claim.Node) int {
+	size := nodeOverhead + len(n.Name())
+	for _, c := range n.Claims() {
+		size += claimOverhead + len(c.Value)
+	}
+	return size + claimOverhead*len(n.Supports())
+}
+
+// get returns the cached node, and marks it as the most recently used.
+func (c *cache) get(name string) (*claim.Node, bool) {
+	e, ok := c.items[name]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.ll.MoveToFront(e)
+	return e.Value.(*item).n, true
+}
+
+// peek returns the cached node without affecting the LRU order or the stats.
+func (c *cache) peek(name string) (*claim.Node, bool) {
+	e, ok := c.items[name]
+	if !ok {
+		return nil, false
+	}
+	return e.Value.(*item).n, true
+}
+
+// put caches the node as the most recently used one.
+func (c *cache) put(n *claim.Node) {
+	it := &item{n: n, size: sizeOf(n)}
+	if e, ok := c.items[n.Name()]; ok {
+		c.stats.Size += it.size - e.Value.(*item).size
+		e.Value = it
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.items[n.Name()] = c.ll.PushFront(it)
+	c.stats.Size += it.size
+}
+
+func (c *cache) remove(name string) {
+	e, ok := c.items[name]
+	if !ok {
+		return
+	}
+	c.ll.Remove(e)
+	delete(c.items, name)
+	c.stats.Size -= e.Value.(*item).size
+}
+
+// evict removes the least recently used nodes until the cache fits in its
+// bound, skipping the pinned ones. The most recently used node is kept.
+func (c *cache) evict(pinned func(name string) bool) {
+	if c.max == 0 {
+		return
+	}
+	for e := c.ll.Back(); e != nil && e != c.ll.Front() && c.stats.Size > c.max; {
+		prev := e.Prev()
+		if name := e.Value.(*item).n.Name(); !pinned(name) {
+			c.remove(name)
+			c.stats.Evictions++
+		}
+		e = prev
+	}
+}
+
+// each visits the cached nodes, from the most recently used one.
+func (c *cache) each(visit func(n *claim.Node) bool) {
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		if visit(e.Value.(*item).n) {
+			return
+		}
+	}
+}
+
+func (c *cache) len() int {
+	return len(c.items)
+}
+
+// SetCacheSize bounds the estimated memory footprint, in bytes, of the cached
+// nodes. Zero means unbounded.
+func (nm *NodeMgr) SetCacheSize(size int) {
+	nm.cachemu.Lock()
+	defer nm.cachemu.Unlock()
+	nm.cache.max = size
+	nm.evict()
+}
+
+// CacheStats returns the statistics of the node cache.
+func (nm *NodeMgr) CacheStats() CacheStats {
+	nm.cachemu.RLock()
+	defer nm.cachemu.RUnlock()
+	stats := nm.cache.stats
+	stats.Nodes = nm.cache.len()
+	return stats
+}
+
+// put caches the node, and evicts others if the cache is full.
+// The cachemu has to be held by the caller.
+func (nm *NodeMgr) put(n *claim.Node) {
+	nm.cache.put(n)
+	nm.evict()
+}
+
+// evict evicts the least recently used nodes if the cache is full.
+// The nodes changed at the pending height are ahead of the replay of their
+// change lists, and the nodes due to update at the pending height are about
+// to be used, so they are never evicted. Other nodes are reloaded by NodeAt
+// when needed.
+// The cachemu has to be held by the caller.
+func (nm *NodeMgr) evict() {
+	pending := nm.height + 1
+	nm.cache.evict(func(name string) bool {
+		if u := nm.undos[pending]; u != nil && u.changed[name] {
+			return true
+		}
+		return nm.due[name]
+	})
+}
+
+// loadDue reads the names of the nodes due to update at the pending height
+// from the schedule, before taking the cachemu, and evicts the other nodes if
+// the cache is full. It's called whenever the height changes.
+func (nm *NodeMgr) loadDue() error {
+	names, err := nm.scheduled(nm.height + 1)
+	if err != nil {
+		return err
+	}
+	due := make(map[string]bool, len(names))
+	for _, name := range names {
+		due[name] = true
+	}
+	nm.cachemu.Lock()
+	defer nm.cachemu.Unlock()
+	nm.due = due
+	nm.evict()
+	return nil
+}
@@ -0,0 +1,266 @@
+package nodemgr
+
+import (
+	"encoding/binary"
+
+	"github.com/lbryio/claimtrie/change"
+	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/storage"
+
+	"github.com/pkg/errors"
+)
+
+// The index database maps the ID of each claim to the name of the node it's
+// in, and the outpoint of each claim and support to its kind, ID and name.
+// The key of an ID holds the ID in the byte order of its hexadecimal form, so
+// the claims can be looked up by the prefix of their IDs.
+const (
+	idPrefix = 'i'
+	opPrefix = 'o'
+)
+
+func idKey(id claim.ID) []byte {
+	key := make([]byte, 1+len(id))
+	key[0] = idPrefix
+	for i := range id {
+		key[1+i] = id[len(id)-1-i]
+	}
+	return key
+}
+
+func keyID(key []byte) claim.ID {
+	var id claim.ID
+	for i := range id {
+		id[i] = key[len(key)-1-i]
+	}
+	return id
+}
+
+func opKey(op claim.OutPoint) []byte {
+	key := make([]byte, 1+len(op.Hash)+4)
+	key[0] = opPrefix
+	copy(key[1:], op.Hash[:])
+	binary.BigEndian.PutUint32(key[1+len(op.Hash):], op.Index)
+	return key
+}
+
+// Kind tells whether an outpoint is a claim or a support.
+type Kind byte
+
+// ...
+const (
+	ClaimKind   Kind = 'c'
+	SupportKind Kind = 's'
+)
+
+// OutPointEntry is the entry of an outpoint in the index.
+type OutPointEntry struct {
+	Name string
+	Kind Kind
+	ID   claim.ID
+}
+
+func (e *OutPointEntry) encode() []byte {
+	val := make([]byte, 0, 1+len(e.ID)+len(e.Name))
+	val = append(val, byte(e.Kind))
+	val = append(val, e.ID[:]...)
+	return append(val, e.Name...)
+}
+
+func decodeOutPointEntry(val []byte) (*OutPointEntry, error) {
+	var e OutPointEntry
+	if len(val) < 1+len(e.ID) {
+		return nil, errors.Errorf("malformed outpoint entry")
+	}
+	e.Kind = Kind(val[0])
+	copy(e.ID[:], val[1:])
+	e.Name = string(val[1+len(e.ID):])
+	return &e, nil
+}
+
+// prior is an entry of the index before it's changed.
+type prior struct {
+	val []byte
+	ok  bool
+}
+
+// NameOf returns the name of the node where the claim of id is.
+// It returns storage.ErrNotFound if the claim doesn't exist.
+func (nm *NodeMgr) NameOf(id claim.ID) (string, error) {
+	name, err := nm.idx.Get(idKey(id))
+	if err != nil {
+		return "", errors.Wrapf(err, "idx.Get(%s)", id)
+	}
+	return string(name), nil
+}
+
+// LookupOutPoint returns the entry of the claim or support of op.
+// It returns storage.ErrNotFound if the outpoint isn't a claim or support.
+func (nm *NodeMgr) LookupOutPoint(op claim.OutPoint) (*OutPointEntry, error) {
+	val, err := nm.idx.Get(opKey(op))
+	if err != nil {
+		return nil, errors.Wrapf(err, "idx.Get(%s)", op)
+	}
+	return decodeOutPointEntry(val)
+}
+
+// IDsWithPrefix returns the IDs of the claims whose IDs, in the hexadecimal
+// form, start with the prefix. At most max IDs are returned, if max > 0.
+// It returns claim.ErrInvalidID if the prefix isn't hexadecimal, or is longer
+// than an ID.
+func (nm *NodeMgr) IDsWithPrefix(prefix string, max int) ([]claim.ID, error) {
+	if err := claim.CheckIDPrefix(prefix); err != nil {
+		return nil, errors.Wrapf(err, "prefix %s", prefix)
+	}
+	b := []byte{idPrefix}
+	for i := 0; i+1 < len(prefix); i += 2 {
+		b = append(b, unhex(prefix[i])<<4|unhex(prefix[i+1]))
+	}
+	var ids []claim.ID
+	iter := nm.idx.NewIterator(b)
+	defer iter.Release()
+	for iter.Next() && (max <= 0 || len(ids) < max) {
+		if id := keyID(iter.Key()); len(prefix)%2 == 0 || unhex(prefix[len(prefix)-1]) == id[len(id)-1-len(prefix)/2]>>4 {
+			ids = append(ids, id)
+		}
+	}
+	return ids, errors.Wrapf(iter.Error(), "iter.Error()")
+}
+
+func unhex(ch byte) byte {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return ch - '0'
+	case ch >= 'a' && ch <= 'f':
+		return ch - 'a' + 10
+	case ch >= 'A' && ch <= 'F':
+		return ch - 'A' + 10
+	}
+	return 0xff
+}
+
+// set puts the val to the key of the index, or deletes the key if val is nil,
+// while processing height ht.
+func (nm *NodeMgr) set(key, val []byte, ht claim.Height) error {
+	if u := nm.record(ht); u.index[string(key)] == nil {
+		old, err := nm.idx.Get(key)
+		if err != nil && err != storage.ErrNotFound {
+			return errors.Wrapf(err, "idx.Get(%x)", key)
+		}
+		u.index[string(key)] = &prior{val: old, ok: err == nil}
+	}
+	if val == nil {
+		return errors.Wrapf(nm.idx.Delete(key), "idx.Delete(%x)", key)
+	}
+	return errors.Wrapf(nm.idx.Put(key, val), "idx.Put(%x)", key)
+}
+
+// index updates the index with the change made to the node n at height ht.
+// The spent claim or support, if any, has to be found before the change is
+// executed.
+func (nm *NodeMgr) index(n *claim.Node, chg *change.Change, spent *claim.Claim, ht claim.Height) error {
+	name := n.Name()
+	put := func(op claim.OutPoint, kind Kind, id claim.ID) error {
+		if kind == ClaimKind {
+			if err := nm.set(idKey(id), []byte(name), ht); err != nil {
+				return err
+			}
+		}
+		e := &OutPointEntry{Name: name, Kind: kind, ID: id}
+		return nm.set(opKey(op), e.encode(), ht)
+	}
+	// The spent one might have been merged into another node.
+	owned := func(key []byte) bool {
+		val, err := nm.idx.Get(key)
+		return err == nil && string(val) == name
+	}
+	switch chg.Cmd {
+	case change.AddClaim:
+		return put(chg.OP, ClaimKind, claim.NewID(chg.OP))
+	case change.UpdateClaim:
+		return put(chg.OP, ClaimKind, chg.ID)
+	case change.AddSupport:
+		return put(chg.OP, SupportKind, chg.ID)
+	case change.SpendClaim:
+		if owned(idKey(spent.ID)) {
+			if err := nm.set(idKey(spent.ID), nil, ht); err != nil {
+				return err
+			}
+		}
+		fallthrough
+	case change.SpendSupport:
+		if e, err := nm.LookupOutPoint(chg.OP); err == nil && e.Name == name {
+			return nm.set(opKey(chg.OP), nil, ht)
+		}
+	case change.MergeNode:
+		for _, c := range n.Claims() {
+			if err := put(c.OutPoint, ClaimKind, c.ID); err != nil {
+				return err
+			}
+		}
+		for _, s := range n.Supports() {
+			if err := put(s.OutPoint, SupportKind, s.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reindex updates the index for the nodes reset to the state before the
+// changes chgs, and returns the first error.
+// Entries added by the changes are removed, if they still belong to the node,
+// and the claims and supports of the nodes are put back.
+func (nm *NodeMgr) reindex(nodes []*claim.Node, chgs [][]*change.Change) error {
+	for i, n := range nodes {
+		for _, chg := range chgs[i] {
+			switch chg.Cmd {
+			case change.AddClaim:
+				id := claim.NewID(chg.OP)
+				if curr, err := nm.NameOf(id); err == nil && curr == n.Name() {
+					if err = nm.idx.Delete(idKey(id)); err != nil {
+						return errors.Wrapf(err, "idx.Delete(%s)", id)
+					}
+				}
+			case change.UpdateClaim, change.AddSupport:
+			default:
+				continue
+			}
+			if e, err := nm.LookupOutPoint(chg.OP); err == nil && e.Name == n.Name() {
+				if err = nm.idx.Delete(opKey(chg.OP)); err != nil {
+					return errors.Wrapf(err, "idx.Delete(%s)", chg.OP)
+				}
+			}
+		}
+	}
+	for _, n := range nodes {
+		for _, c := range n.Claims() {
+			e := &OutPointEntry{Name: n.Name(), Kind: ClaimKind, ID: c.ID}
+			if err := nm.idx.Put(idKey(c.ID), []byte(n.Name())); err != nil {
+				return errors.Wrapf(err, "idx.Put(%s)", c.ID)
+			}
+			if err := nm.idx.Put(opKey(c.OutPoint), e.encode()); err != nil {
+				return errors.Wrapf(err, "idx.Put(%s)", c.OutPoint)
+			}
+		}
+		for _, s := range n.Supports() {
+			e := &OutPointEntry{Name: n.Name(), Kind: SupportKind, ID: s.ID}
+			if err := nm.idx.Put(opKey(s.OutPoint), e.encode()); err != nil {
+				return errors.Wrapf(err, "idx.Put(%s)", s.OutPoint)
+			}
+		}
+	}
+	return nil
+}
+
+// indexed tells whether the index has both kinds of the entries.
+// Otherwise, it has to be built from all nodes.
+func (nm *NodeMgr) indexed() bool {
+	complete := true
+	for _, prefix := range []byte{idPrefix, opPrefix} {
+		iter := nm.idx.NewIterator([]byte{prefix})
+		complete = complete && iter.Next()
+		iter.Release()
+	}
+	return complete
+}
@@ -1,75 +1,167 @@
 package nodemgr
 
 import (
-	"bytes"
-	"encoding/gob"
 	"fmt"
 	"sort"
 	"sync"
 
 	"github.com/lbryio/claimtrie/change"
 	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/storage"
 	"github.com/lbryio/claimtrie/trie"
 
 	"github.com/pkg/errors"
-	"github.com/syndtr/goleveldb/leveldb"
 )
 
 // NodeMgr ...
 type NodeMgr struct {
+	params *claim.Params
 	height claim.Height
-	db     *leveldb.DB
+	db     storage.DB
+	idx    storage.DB
 
-	// cachemu synchronizes the access to the map itself, but not the
+	// cachemu synchronizes the access to the cache itself, but not the
 	// values of the node.
-	cachemu     sync.RWMutex
-	cache       map[string]*claim.Node
-	nextUpdates todos
+	cachemu sync.RWMutex
+	cache   *cache
+
+	// due holds the names of the nodes scheduled to update at the pending
+	// height, which are kept in the cache.
+	due map[string]bool
+
+	// undos holds the undo records of the heights from undoFrom, including
+	// the one of the changes not committed yet.
+	undos     map[claim.Height]*undo
+	undoFrom  claim.Height
+	undoDepth int
+
+	// snapInterval and snapChanges tell when the snapshots are taken.
+	snapInterval claim.Height
+	snapChanges  int
 }
 
-// New ...
-func New(db *leveldb.DB) *NodeMgr {
+// New returns a NodeMgr, whose nodes are governed by the params p.
+// The changes of the nodes are kept in db, and the index of the claims, the
+// schedule of the updates and the snapshots of the nodes in idx.
+func New(db, idx storage.DB, p *claim.Params) *NodeMgr {
 	nm := &NodeMgr{
-		db:          db,
-		cache:       map[string]*claim.Node{},
-		nextUpdates: todos{},
+		params: p,
+		db:     db,
+		idx:    idx,
+		cache:  newCache(),
+		due:    map[string]bool{},
+		undos:  map[claim.Height]*undo{},
 	}
 	return nm
 }
 
-// Load loads the nodes from the database up to height ht.
-func (nm *NodeMgr) Load(ht claim.Height) {
-
+// Load sets the height of the nodes to ht. The nodes are loaded from the
+// database when they are used, and kept in the cache as long as it has room
+// for them. The index, the schedule and the tip are built from all nodes if
+// the database has none.
+func (nm *NodeMgr) Load(ht claim.Height) error {
 	nm.height = ht
-	iter := nm.db.NewIterator(nil, nil)
-	nm.cachemu.Lock()
+	nm.clearUndos(ht)
+	ok, err := nm.built()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := nm.build(ht); err != nil {
+			return err
+		}
+	}
+	return nm.loadDue()
+}
+
+// Names returns the names of all nodes in the database.
+func (nm *NodeMgr) Names() []string {
+	var names []string
+	iter := nm.db.NewIterator(nil)
 	for iter.Next() {
-		name := string(iter.Key())
-		nm.cache[name] = nm.load(name, ht)
+		names = append(names, string(iter.Key()))
 	}
-	nm.cachemu.Unlock()
+	iter.Release()
+	return names
+}
 
-	data, err := nm.db.Get([]byte("nextUpdates"), nil)
-	if err == leveldb.ErrNotFound {
-		return
-	} else if err != nil {
-		panic(err)
+// Truncate removes the changes that have height larger than ht from the
+// database, and resets the nodes to ht.
+func (nm *NodeMgr) Truncate(ht claim.Height) error {
+	var nodes []*claim.Node
+	var removed [][]*change.Change
+	for _, name := range nm.Names() {
+		cl := change.NewChangeList(nm.db, name).Load()
+		if err := cl.Err(); err != nil {
+			return errors.Wrapf(err, "load %s", name)
+		}
+		chgs := cl.Changes()
+		if cl.Truncate(ht); len(cl.Changes()) == len(chgs) {
+			continue
+		}
+		if err := cl.Save().Err(); err != nil {
+			return errors.Wrapf(err, "truncate %s", name)
+		}
+		if err := nm.dropSnapshots(name, ht); err != nil {
+			return err
+		}
+		n, err := nm.rebuild(name, cl.Changes(), ht)
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, n)
+		removed = append(removed, chgs[len(cl.Changes()):])
 	}
-	if err = gob.NewDecoder(bytes.NewBuffer(data)).Decode(&nm.nextUpdates); err != nil {
-		panic(err)
+	if err := nm.reindex(nodes, removed); err != nil {
+		return errors.Wrapf(err, "reindex()")
 	}
+	return nm.Reset(ht)
 }
 
-// Save saves the states to the database.
-func (nm *NodeMgr) Save() error {
-	buf := bytes.NewBuffer(nil)
-	if err := gob.NewEncoder(buf).Encode(nm.nextUpdates); err != nil {
-		return errors.Wrapf(err, "gob.Encode()")
+// KeyValueAt returns a trie.KeyValue which serves the nodes at height ht.
+func (nm *NodeMgr) KeyValueAt(ht claim.Height) trie.KeyValue {
+	return nodesAt{nm: nm, ht: ht}
+}
+
+type nodesAt struct {
+	nm *NodeMgr
+	ht claim.Height
+}
+
+func (v nodesAt) Get(key []byte) trie.Value {
+	return v.nm.NodeAt(string(key), v.ht)
+}
+
+// ReplayAt returns a trie.KeyValue which serves the nodes at height ht,
+// replayed from all of their changes, including the ones of the nodes merged
+// into them. Unlike KeyValueAt, it bypasses the cache and the snapshots, so
+// the change lists can be checked on their own.
+// Like NodeAt, it panics if a node can't be read from the database.
+func (nm *NodeMgr) ReplayAt(ht claim.Height) trie.KeyValue {
+	return replayedAt{nm: nm, ht: ht}
+}
+
+type replayedAt struct {
+	nm *NodeMgr
+	ht claim.Height
+}
+
+func (v replayedAt) Get(key []byte) trie.Value {
+	return must(v.nm.replayAll(string(key), v.ht))
+}
+
+// replayAll returns the node at height ht, replayed from all of its changes
+// without the snapshots.
+func (nm *NodeMgr) replayAll(name string, ht claim.Height) (*claim.Node, error) {
+	cl := change.NewChangeList(nm.db, name).Load()
+	if err := cl.Err(); err != nil {
+		return nil, errors.Wrapf(err, "load %s", name)
 	}
-	if err := nm.db.Put([]byte("nextUpdates"), buf.Bytes(), nil); err != nil {
-		return errors.Wrapf(err, "db.Put()")
+	n := claim.NewNode(name, nm.params)
+	if err := nm.replay(n, cl.Truncate(ht).Changes(), nm.replayAll); err != nil {
+		return nil, err
 	}
-	return nil
+	return n.AdjustTo(ht), nil
 }
 
 // Get returns the latest node with name specified by key.
@@ -78,86 +170,225 @@ func (nm *NodeMgr) Get(key []byte) trie.Value {
 }
 
 // Reset resets all nodes to specified height.
-func (nm *NodeMgr) Reset(ht claim.Height) {
+// Changes beyond the height are removed from the database, so the changes
+// made afterward are appended to a consistent history.
+//
+// Within the undo depth, only the nodes touched after the height are reverted
+// with the undo records. Otherwise, the nodes are replayed from the changes.
+// The undo records are kept in memory only, and don't survive a restart, so
+// a Reset right after a Load replays all nodes changed after the height.
+// The nodes evicted from the cache are replayed only if they have changes
+// after the height.
+func (nm *NodeMgr) Reset(ht claim.Height) error {
 	nm.cachemu.Lock()
-	defer nm.cachemu.Unlock()
+	err := nm.reset(ht)
+	nm.cachemu.Unlock()
+	if err != nil {
+		return err
+	}
+	return nm.loadDue()
+}
+
+// reset is Reset, with the cachemu held by the caller.
+func (nm *NodeMgr) reset(ht claim.Height) error {
+	if err := nm.lowerTip(ht); err != nil {
+		return err
+	}
+	if ok, err := nm.undo(ht); ok {
+		nm.height = ht
+		return err
+	}
 	nm.height = ht
-	for name, n := range nm.cache {
-		if n.Height() >= ht {
-			nm.cache[name] = nm.load(name, ht)
+	nm.clearUndos(ht)
+	var nodes []*claim.Node
+	var removed [][]*change.Change
+	for _, name := range nm.Names() {
+		// The cached nodes below the height are still valid. The ones at or
+		// beyond it may have changes after it, so they are rebuilt.
+		n, ok := nm.cache.peek(name)
+		if ok && n.Height() < ht {
+			continue
+		}
+		cl := change.NewChangeList(nm.db, name).Load()
+		if err := cl.Err(); err != nil {
+			return errors.Wrapf(err, "load %s", name)
+		}
+		chgs := cl.Changes()
+		if len(cl.Truncate(ht).Changes()) != len(chgs) {
+			if err := cl.Save().Err(); err != nil {
+				return errors.Wrapf(err, "truncate %s", name)
+			}
+			if err := nm.dropSnapshots(name, ht); err != nil {
+				return err
+			}
+		} else if !ok {
+			continue
+		}
+		var err error
+		if n, err = nm.rebuild(name, cl.Changes(), ht); err != nil {
+			return err
 		}
+		nm.cache.put(n)
+		if err := nm.schedule(n); err != nil {
+			return err
+		}
+		nodes = append(nodes, n)
+		removed = append(removed, chgs[len(cl.Changes()):])
 	}
+	return errors.Wrapf(nm.reindex(nodes, removed), "reindex()")
+}
+
+// Params returns the parameters governing the nodes.
+func (nm *NodeMgr) Params() *claim.Params {
+	return nm.params
 }
 
 // Size returns the number of nodes loaded into the cache.
 func (nm *NodeMgr) Size() int {
 	nm.cachemu.RLock()
 	defer nm.cachemu.RUnlock()
-	return len(nm.cache)
+	return nm.cache.len()
+}
+
+func (nm *NodeMgr) load(name string, ht claim.Height) (*claim.Node, error) {
+	cl := change.NewChangeList(nm.db, name).Load()
+	if err := cl.Err(); err != nil {
+		return nil, errors.Wrapf(err, "load %s", name)
+	}
+	return nm.rebuild(name, cl.Truncate(ht).Changes(), ht)
 }
 
-func (nm *NodeMgr) load(name string, ht claim.Height) *claim.Node {
-	c := change.NewChangeList(nm.db, name).Load().Truncate(ht).Changes()
-	return replay(name, c).AdjustTo(ht)
+// must returns the node, or panics with the error.
+func must(n *claim.Node, err error) *claim.Node {
+	if err != nil {
+		panic(err)
+	}
+	return n
 }
 
 // NodeAt returns the node adjusted to specified height.
+// The node missing from the cache is loaded from the database, and cached
+// unless it's queried at an earlier height. The cache only holds the nodes
+// at the current height, so the queries at earlier heights bypass it, and
+// rebuild the node on every call. Rebuild serves them without touching the
+// cache, and is preferred for them.
+// It panics if the node can't be read from the database, since it serves
+// the trie and the queries, which have no way to return the error.
 func (nm *NodeMgr) NodeAt(name string, ht claim.Height) *claim.Node {
+	return must(nm.nodeAt(name, ht))
+}
+
+// nodeAt is NodeAt, which returns the error instead.
+func (nm *NodeMgr) nodeAt(name string, ht claim.Height) (*claim.Node, error) {
+	var err error
 	nm.cachemu.Lock()
-	n, ok := nm.cache[name]
-	if !ok {
-		n = claim.NewNode(name)
-		nm.cache[name] = n
+	n, ok := nm.cache.get(name)
+	if !ok && ht >= nm.height {
+		if n, err = nm.load(name, nm.height); err == nil {
+			nm.put(n)
+		}
 	}
 	nm.cachemu.Unlock()
+	if err != nil {
+		return nil, err
+	}
 
-	// Cached version is too new.
-	if n.Height() > nm.height || n.Height() > ht {
-		n = nm.load(name, ht)
+	// Not cached, or cached version is too new.
+	if n == nil || n.Height() > nm.height || n.Height() > ht {
+		if n, err = nm.load(name, ht); err != nil {
+			return nil, err
+		}
 	}
-	return n.AdjustTo(ht)
+	return n.AdjustTo(ht), nil
+}
+
+// Rebuild returns the node at height ht, rebuilt from its latest snapshot and
+// changes. Unlike NodeAt, it leaves the cache untouched, so it's safe for
+// concurrent use with the updates beyond ht.
+// Like NodeAt, it panics if the node can't be read from the database.
+func (nm *NodeMgr) Rebuild(name string, ht claim.Height) *claim.Node {
+	return must(nm.load(name, ht))
 }
 
 // ModifyNode returns the node adjusted to specified height.
 func (nm *NodeMgr) ModifyNode(name string, chg *change.Change) error {
 	ht := nm.height
-	n := nm.NodeAt(name, ht)
-	n.AdjustTo(ht)
-	if err := execute(n, chg); err != nil {
+	nm.cachemu.Lock()
+	err := nm.touch(name, ht+1)
+	nm.cachemu.Unlock()
+	if err != nil {
+		return err
+	}
+	n, err := nm.nodeAt(name, ht)
+	if err != nil {
+		return err
+	}
+	spent := claim.Find(claim.ByOP(chg.OP), n.Claims(), n.Supports())
+	if err := nm.execute(n, chg, nm.load); err != nil {
 		return errors.Wrapf(err, "claim.execute(n,chg)")
 	}
 	nm.cachemu.Lock()
-	nm.cache[name] = n
+	nm.record(ht + 1).changed[name] = true
+	nm.put(n)
 	nm.cachemu.Unlock()
-	nm.nextUpdates.set(name, ht+1)
-	change.NewChangeList(nm.db, name).Load().Append(chg).Save()
-	return nil
+	if err := nm.setNext(name, ht+1, ht+1); err != nil {
+		return errors.Wrapf(err, "setNext()")
+	}
+	if err := nm.setTip(ht + 1); err != nil {
+		return errors.Wrapf(err, "setTip()")
+	}
+	if err := change.NewChangeList(nm.db, name).Load().Append(chg).Save().Err(); err != nil {
+		return errors.Wrapf(err, "save %s", name)
+	}
+	return errors.Wrapf(nm.index(n, chg, spent, ht+1), "index()")
 }
 
 // CatchUp ...
-func (nm *NodeMgr) CatchUp(ht claim.Height, notifier func(key []byte)) {
+func (nm *NodeMgr) CatchUp(ht claim.Height, notifier func(key []byte)) error {
 	nm.height = ht
-	for name := range nm.nextUpdates[ht] {
+	names, err := nm.scheduled(ht)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		nm.cachemu.Lock()
+		err := nm.touch(name, ht)
+		nm.cachemu.Unlock()
+		if err != nil {
+			return err
+		}
 		notifier([]byte(name))
-		if next := nm.NodeAt(name, ht).NextUpdate(); next > ht {
-			nm.nextUpdates.set(name, next)
+		n, err := nm.nodeAt(name, ht)
+		if err != nil {
+			return err
+		}
+		if next := n.NextUpdate(); next > ht {
+			if err := nm.setNext(name, next, ht); err != nil {
+				return errors.Wrapf(err, "setNext()")
+			}
+		}
+	}
+	if u := nm.undos[ht]; u != nil {
+		for name := range u.changed {
+			if err := nm.snapshot(name, ht); err != nil {
+				return errors.Wrapf(err, "snapshot %s", name)
+			}
 		}
 	}
+	nm.prune(ht)
+	return nm.loadDue()
 }
 
 // VisitFunc visit each node in read-only manner.
 type VisitFunc func(n *claim.Node) (stop bool)
 
-// Visit visits every node in the cache with VisitFunc.
+// Visit visits every node in the cache with VisitFunc, from the most
+// recently used one. The nodes evicted from the cache aren't visited.
 // If the VisitFunc returns true, the iteration ends immediately.
 func (nm *NodeMgr) Visit(v VisitFunc) {
 	nm.cachemu.RLock()
 	defer nm.cachemu.RUnlock()
-	for _, n := range nm.cache {
-		if v(n) {
-			return
-		}
-	}
+	nm.cache.each(v)
 }
 
 // Show is a conevenient function for debugging purpose.
@@ -167,13 +398,14 @@ func (nm *NodeMgr) Show(name string, ht claim.Height, dump bool) error {
 	if len(name) != 0 {
 		names = append(names, name)
 	} else {
-		for name := range nm.cache {
-			names = append(names, name)
-		}
+		names = nm.Names()
 	}
 	sort.Strings(names)
 	for _, name := range names {
-		n := nm.NodeAt(name, ht)
+		n, err := nm.nodeAt(name, ht)
+		if err != nil {
+			return err
+		}
 		if n.BestClaim() == nil {
 			continue
 		}
@@ -185,22 +417,26 @@ func (nm *NodeMgr) Show(name string, ht claim.Height, dump bool) error {
 	return nil
 }
 
-func replay(name string, chgs []*change.Change) *claim.Node {
-	n := claim.NewNode(name)
+// replay applies the changes to the node, which is adjusted along the way.
+// The nodes merged into it are loaded by load.
+func (nm *NodeMgr) replay(n *claim.Node, chgs []*change.Change, load loader) error {
 	for _, chg := range chgs {
 		if n.Height() < chg.Height-1 {
 			n.AdjustTo(chg.Height - 1)
 		}
 		if n.Height() == chg.Height-1 {
-			if err := execute(n, chg); err != nil {
-				panic(err)
+			if err := nm.execute(n, chg, load); err != nil {
+				return err
 			}
 		}
 	}
-	return n
+	return nil
 }
 
-func execute(n *claim.Node, c *change.Change) error {
+// loader returns the node of the name at height ht.
+type loader func(name string, ht claim.Height) (*claim.Node, error)
+
+func (nm *NodeMgr) execute(n *claim.Node, c *change.Change, load loader) error {
 	var err error
 	switch c.Cmd {
 	case change.AddClaim:
@@ -213,15 +449,11 @@ func execute(n *claim.Node, c *change.Change) error {
 		err = n.AddSupport(c.OP, c.Amt, c.ID)
 	case change.SpendSupport:
 		err = n.SpendSupport(c.OP)
+	case change.MergeNode:
+		var m *claim.Node
+		if m, err = load(string(c.Value), c.Height-1); err == nil {
+			err = n.Merge(m)
+		}
 	}
 	return errors.Wrapf(err, "chg %s", c)
 }
-
-type todos map[claim.Height]map[string]bool
-
-func (t todos) set(name string, ht claim.Height) {
-	if t[ht] == nil {
-		t[ht] = map[string]bool{}
-	}
-	t[ht][name] = true
-}
@@ -0,0 +1,117 @@
+package nodemgr
+
+import (
+	"testing"
+
+	"github.com/lbryio/claimtrie/change"
+	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/storage"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/pkg/errors"
+)
+
+func newTestNodeMgr(t *testing.T) *NodeMgr {
+	p := claim.RegTestParams
+	nm := New(storage.NewMemDB(), storage.NewMemDB(), &p)
+	if err := nm.Load(0); err != nil {
+		t.Fatal(err)
+	}
+	return nm
+}
+
+// modify applies the change to the node of the name at the next height, and
+// catches up to it.
+func modify(t *testing.T, nm *NodeMgr, name string, chg *change.Change) {
+	ht := nm.height + 1
+	if err := nm.ModifyNode(name, chg.SetHeight(ht).SetName(name)); err != nil {
+		t.Fatal(err)
+	}
+	if err := nm.CatchUp(ht, func([]byte) {}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplayAtMergedSnapshot(t *testing.T) {
+	nm := newTestNodeMgr(t)
+	op := *claim.NewOutPoint(&chainhash.Hash{1}, 0)
+	modify(t, nm, "A", change.New(change.AddClaim).SetOP(op).SetAmt(1))
+	modify(t, nm, "a", change.New(change.MergeNode).SetValue([]byte("A")))
+
+	// A snapshot of the merged node, which doesn't match its changes.
+	forged := claim.NewNode("A", nm.params)
+	if err := forged.AddClaim(*claim.NewOutPoint(&chainhash.Hash{2}, 0), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := forged.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nm.idx.Put(snapKey("A", 1), data); err != nil {
+		t.Fatal(err)
+	}
+
+	n := nm.ReplayAt(2).Get([]byte("a")).(*claim.Node)
+	if len(n.Claims()) != 1 || n.Claims()[0].OutPoint != op {
+		t.Fatalf("replayed claims %v, want the one of %s", n.Claims(), op)
+	}
+}
+
+// failingDB fails all reads once err is set.
+type failingDB struct {
+	storage.DB
+	err error
+}
+
+func (db *failingDB) Get(key []byte) ([]byte, error) {
+	if db.err != nil {
+		return nil, db.err
+	}
+	return db.DB.Get(key)
+}
+
+func (db *failingDB) Has(key []byte) (bool, error) {
+	if db.err != nil {
+		return false, db.err
+	}
+	return db.DB.Has(key)
+}
+
+func (db *failingDB) NewIterator(prefix []byte) storage.Iterator {
+	iter := db.DB.NewIterator(prefix)
+	if db.err != nil {
+		return failingIterator{iter, db.err}
+	}
+	return iter
+}
+
+type failingIterator struct {
+	storage.Iterator
+	err error
+}
+
+func (it failingIterator) Next() bool   { return false }
+func (it failingIterator) Error() error { return it.err }
+
+func TestIndexErrors(t *testing.T) {
+	p := claim.RegTestParams
+	idx := &failingDB{DB: storage.NewMemDB()}
+	nm := New(storage.NewMemDB(), idx, &p)
+	if err := nm.Load(0); err != nil {
+		t.Fatal(err)
+	}
+	idx.err = errors.New("read failure")
+	chg := change.New(change.AddClaim).SetOP(*claim.NewOutPoint(&chainhash.Hash{1}, 0)).SetAmt(1)
+	if err := nm.ModifyNode("a", chg.SetHeight(1).SetName("a")); errors.Cause(err) != idx.err {
+		t.Errorf("ModifyNode(): %v", err)
+	}
+	if err := nm.CatchUp(1, func([]byte) {}); errors.Cause(err) != idx.err {
+		t.Errorf("CatchUp(): %v", err)
+	}
+	if _, err := nm.Tip(); errors.Cause(err) != idx.err {
+		t.Errorf("Tip(): %v", err)
+	}
+	if err := nm.Load(1); errors.Cause(err) != idx.err {
+		t.Errorf("Load(): %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package nodemgr
+
+import (
+	"encoding/binary"
+
+	"github.com/lbryio/claimtrie/change"
+	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/storage"
+
+	"github.com/pkg/errors"
+)
+
+// The index database also holds the schedule of the updates of the nodes,
+// keyed by the height and the name, and the tip, which is the highest height
+// of the changes. So the nodes are loaded only when they are used.
+//
+// The scheduled updates are kept after they happen, so a Reset to an earlier
+// height finds them. An update scheduled for a state which has been reset
+// merely updates the node in the trie with the same hash.
+//
+// The tip is written along with the schedule and the index. So its absence
+// tells they have to be built from all nodes.
+const (
+	schedPrefix = 'u'
+	tipPrefix   = 't'
+)
+
+func schedHeightKey(ht claim.Height) []byte {
+	key := make([]byte, 1+4)
+	key[0] = schedPrefix
+	binary.BigEndian.PutUint32(key[1:], uint32(ht))
+	return key
+}
+
+func schedKey(name string, ht claim.Height) []byte {
+	return append(schedHeightKey(ht), name...)
+}
+
+func heightBytes(ht claim.Height) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(ht))
+	return b
+}
+
+// Tip returns the highest height of the changes in the database.
+func (nm *NodeMgr) Tip() (claim.Height, error) {
+	b, err := nm.idx.Get([]byte{tipPrefix})
+	if err == storage.ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Wrapf(err, "idx.Get(tip)")
+	}
+	return claim.Height(binary.BigEndian.Uint32(b)), nil
+}
+
+// scheduled returns the names of the nodes scheduled to update at height ht.
+func (nm *NodeMgr) scheduled(ht claim.Height) ([]string, error) {
+	var names []string
+	prefix := schedHeightKey(ht)
+	iter := nm.idx.NewIterator(prefix)
+	for iter.Next() {
+		names = append(names, string(iter.Key()[len(prefix):]))
+	}
+	err := iter.Error()
+	iter.Release()
+	return names, errors.Wrapf(err, "iterate schedule at %d", ht)
+}
+
+// isScheduled tells whether the node is scheduled to update at height ht.
+func (nm *NodeMgr) isScheduled(name string, ht claim.Height) (bool, error) {
+	ok, err := nm.idx.Has(schedKey(name, ht))
+	return ok, errors.Wrapf(err, "idx.Has(schedule %s)", name)
+}
+
+// setNext schedules an update of the node at height next, while processing
+// height ht.
+func (nm *NodeMgr) setNext(name string, next, ht claim.Height) error {
+	if ok, err := nm.isScheduled(name, next); err != nil || ok {
+		return err
+	}
+	if err := nm.set(schedKey(name, next), []byte{}, ht); err != nil {
+		return err
+	}
+	if next == nm.height+1 {
+		nm.cachemu.Lock()
+		nm.due[name] = true
+		nm.cachemu.Unlock()
+	}
+	return nil
+}
+
+// setTip raises the tip to height ht, while processing it.
+func (nm *NodeMgr) setTip(ht claim.Height) error {
+	if tip, err := nm.Tip(); err != nil || tip >= ht {
+		return err
+	}
+	return nm.set([]byte{tipPrefix}, heightBytes(ht), ht)
+}
+
+// lowerTip lowers the tip to height ht, as the changes beyond are removed.
+func (nm *NodeMgr) lowerTip(ht claim.Height) error {
+	if tip, err := nm.Tip(); err != nil || tip <= ht {
+		return err
+	}
+	return errors.Wrapf(nm.idx.Put([]byte{tipPrefix}, heightBytes(ht)), "idx.Put(tip)")
+}
+
+// schedule sets the next update of the node, if it has one pending.
+// It's used without undo records, when the nodes are reset or built.
+func (nm *NodeMgr) schedule(n *claim.Node) error {
+	if next := n.NextUpdate(); next > n.Height() {
+		return errors.Wrapf(nm.idx.Put(schedKey(n.Name(), next), []byte{}), "idx.Put(schedule %s)", n.Name())
+	}
+	return nil
+}
+
+// built tells whether the index and the schedule have been built.
+func (nm *NodeMgr) built() (bool, error) {
+	ok, err := nm.idx.Has([]byte{tipPrefix})
+	return ok, errors.Wrapf(err, "idx.Has(tip)")
+}
+
+// build builds the index, the schedule and the tip from all nodes at height
+// ht, for a database written before they were kept. The nodes are built one
+// at a time, and left out of the cache.
+func (nm *NodeMgr) build(ht claim.Height) error {
+	var tip claim.Height
+	for _, name := range nm.Names() {
+		cl := change.NewChangeList(nm.db, name).Load()
+		if err := cl.Err(); err != nil {
+			return errors.Wrapf(err, "load %s", name)
+		}
+		for _, chg := range cl.Changes() {
+			if chg.Height > tip {
+				tip = chg.Height
+			}
+		}
+		n, err := nm.rebuild(name, cl.Truncate(ht).Changes(), ht)
+		if err != nil {
+			return err
+		}
+		if err := nm.schedule(n); err != nil {
+			return err
+		}
+		if err := nm.reindex([]*claim.Node{n}, [][]*change.Change{nil}); err != nil {
+			return errors.Wrapf(err, "reindex()")
+		}
+	}
+	return errors.Wrapf(nm.idx.Put([]byte{tipPrefix}, heightBytes(tip)), "idx.Put(tip)")
+}
+
+// DropSchedule removes the schedule and the tip from the index database, as
+// if it was written before they were kept, so the next Load builds them from
+// all nodes. It's meant for the tests of the migration.
+func (nm *NodeMgr) DropSchedule() error {
+	var keys [][]byte
+	for _, prefix := range []byte{schedPrefix, tipPrefix} {
+		iter := nm.idx.NewIterator([]byte{prefix})
+		for iter.Next() {
+			keys = append(keys, append([]byte(nil), iter.Key()...))
+		}
+		err := iter.Error()
+		iter.Release()
+		if err != nil {
+			return errors.Wrapf(err, "iterate %c", prefix)
+		}
+	}
+	for _, key := range keys {
+		if err := nm.idx.Delete(key); err != nil {
+			return errors.Wrapf(err, "idx.Delete(%x)", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package nodemgr
+
+import (
+	"encoding/binary"
+
+	"github.com/lbryio/claimtrie/change"
+	"github.com/lbryio/claimtrie/claim"
+
+	"github.com/pkg/errors"
+)
+
+// The snapshots of the nodes are kept in the index database, keyed by the
+// length of the name, the name and the height of the snapshot. So the
+// snapshots of a name can be iterated by its prefix, from the lowest height.
+const snapPrefix = 's'
+
+func snapNameKey(name string) []byte {
+	key := make([]byte, 1+binary.MaxVarintLen64, 1+binary.MaxVarintLen64+len(name)+4)
+	key[0] = snapPrefix
+	key = key[:1+binary.PutUvarint(key[1:], uint64(len(name)))]
+	return append(key, name...)
+}
+
+func snapKey(name string, ht claim.Height) []byte {
+	key := append(snapNameKey(name), 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(key[len(key)-4:], uint32(ht))
+	return key
+}
+
+func keyHeight(key []byte) claim.Height {
+	return claim.Height(binary.BigEndian.Uint32(key[len(key)-4:]))
+}
+
+// SetSnapshotPolicy sets when the snapshots of the nodes are taken.
+// A node changed at a height is snapshotted if the interval has passed, or it
+// has had the number of changes, since its latest snapshot. Zero disables
+// either of the conditions.
+func (nm *NodeMgr) SetSnapshotPolicy(interval claim.Height, changes int) {
+	nm.snapInterval = interval
+	nm.snapChanges = changes
+}
+
+// snapshot takes the snapshot of the node at height ht, if it's due.
+// The node has to be changed at ht, so the snapshot is dropped whenever the
+// change list is truncated below it.
+func (nm *NodeMgr) snapshot(name string, ht claim.Height) error {
+	if nm.snapInterval == 0 && nm.snapChanges == 0 {
+		return nil
+	}
+	last, _, err := nm.latestSnapshot(name, ht, false)
+	if err != nil {
+		return err
+	}
+	chgs := change.NewChangeList(nm.db, name).Load().Truncate(ht).Changes()
+	if last == 0 && len(chgs) > 0 {
+		last = chgs[0].Height
+	}
+	cnt := 0
+	for _, chg := range chgs {
+		if chg.Height > last {
+			cnt++
+		}
+	}
+	if (nm.snapInterval == 0 || ht-last < nm.snapInterval) && (nm.snapChanges == 0 || cnt < nm.snapChanges) {
+		return nil
+	}
+	n, err := nm.nodeAt(name, ht)
+	if err != nil {
+		return err
+	}
+	data, err := n.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(nm.idx.Put(snapKey(name, ht), data), "idx.Put(snapshot %s)", name)
+}
+
+// latestSnapshot returns the height of the latest snapshot of the name at or
+// below height ht, and decodes its node if restore is set.
+// It returns zero height if there's none.
+func (nm *NodeMgr) latestSnapshot(name string, ht claim.Height, restore bool) (claim.Height, *claim.Node, error) {
+	var last claim.Height
+	var data []byte
+	iter := nm.idx.NewIterator(snapNameKey(name))
+	for iter.Next() {
+		h := keyHeight(iter.Key())
+		if h > ht {
+			break
+		}
+		last = h
+		if restore {
+			data = append(data[:0], iter.Value()...)
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return 0, nil, errors.Wrapf(err, "iterate snapshots of %s", name)
+	}
+	if data == nil {
+		return last, nil, nil
+	}
+	n, err := claim.UnmarshalNode(data, nm.params)
+	return last, n, errors.Wrapf(err, "snapshot %s at %d", name, last)
+}
+
+// dropSnapshots removes the snapshots of the name above height ht.
+func (nm *NodeMgr) dropSnapshots(name string, ht claim.Height) error {
+	var keys [][]byte
+	iter := nm.idx.NewIterator(snapNameKey(name))
+	for iter.Next() {
+		if keyHeight(iter.Key()) > ht {
+			keys = append(keys, append([]byte(nil), iter.Key()...))
+		}
+	}
+	iter.Release()
+	for _, key := range keys {
+		if err := nm.idx.Delete(key); err != nil {
+			return errors.Wrapf(err, "idx.Delete(snapshot %s)", name)
+		}
+	}
+	return nil
+}
+
+// rebuild returns the node of the name at height ht, replayed from the
+// changes, which are truncated to ht. The replay starts from the latest
+// snapshot at or below ht, if any.
+func (nm *NodeMgr) rebuild(name string, chgs []*change.Change, ht claim.Height) (*claim.Node, error) {
+	_, n, err := nm.latestSnapshot(name, ht, true)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		n = claim.NewNode(name, nm.params)
+	} else {
+		i := len(chgs)
+		for i > 0 && chgs[i-1].Height > n.Height() {
+			i--
+		}
+		chgs = chgs[i:]
+	}
+	if err := nm.replay(n, chgs, nm.load); err != nil {
+		return nil, err
+	}
+	return n.AdjustTo(ht), nil
+}
@@ -0,0 +1,125 @@
+package nodemgr
+
+import (
+	"github.com/lbryio/claimtrie/change"
+	"github.com/lbryio/claimtrie/claim"
+
+	"github.com/pkg/errors"
+)
+
+// undo holds the data to revert the nodes to the state before a height.
+type undo struct {
+	// nodes holds the prior state of the nodes touched at the height.
+	// A nil node wasn't cached, and is reloaded when needed.
+	nodes map[string]*claim.Node
+
+	// changed holds the names which have changes at the height.
+	changed map[string]bool
+
+	// index holds the prior entries of the index, including the schedule and
+	// the tip, changed at the height.
+	index map[string]*prior
+}
+
+// SetUndoDepth sets the number of recent heights kept with undo records.
+func (nm *NodeMgr) SetUndoDepth(depth int) {
+	nm.undoDepth = depth
+}
+
+// record returns the undo record of height ht.
+func (nm *NodeMgr) record(ht claim.Height) *undo {
+	u := nm.undos[ht]
+	if u == nil {
+		u = &undo{
+			nodes:   map[string]*claim.Node{},
+			changed: map[string]bool{},
+			index:   map[string]*prior{},
+		}
+		nm.undos[ht] = u
+	}
+	return u
+}
+
+// touch saves the state of the node, before it's modified at height ht.
+// The cachemu has to be held by the caller.
+func (nm *NodeMgr) touch(name string, ht claim.Height) error {
+	u := nm.record(ht)
+	if _, ok := u.nodes[name]; ok {
+		return nil
+	}
+	n, ok := nm.cache.peek(name)
+	switch {
+	case !ok:
+		u.nodes[name] = nil
+	case n.Height() < ht:
+		u.nodes[name] = n.Clone()
+	default:
+		// The cached node has been adjusted beyond by a query.
+		n, err := nm.load(name, ht-1)
+		if err != nil {
+			return err
+		}
+		u.nodes[name] = n
+	}
+	return nil
+}
+
+// prune drops the undo records beyond the undo depth from height ht.
+func (nm *NodeMgr) prune(ht claim.Height) {
+	for nm.undoFrom <= ht-claim.Height(nm.undoDepth) {
+		delete(nm.undos, nm.undoFrom)
+		nm.undoFrom++
+	}
+}
+
+// clearUndos drops all undo records. Heights above ht can be undone after.
+// The undo records are kept in memory only, so they are cleared on Load.
+func (nm *NodeMgr) clearUndos(ht claim.Height) {
+	nm.undos = map[claim.Height]*undo{}
+	nm.undoFrom = ht + 1
+}
+
+// undo reverts the nodes to height ht with the undo records, if available.
+// The cachemu has to be held by the caller.
+func (nm *NodeMgr) undo(ht claim.Height) (bool, error) {
+	if ht+1 < nm.undoFrom {
+		return false, nil
+	}
+	for h := nm.height + 1; h > ht; h-- {
+		u := nm.undos[h]
+		if u == nil {
+			continue
+		}
+		for name, n := range u.nodes {
+			if n == nil {
+				nm.cache.remove(name)
+				continue
+			}
+			nm.cache.put(n)
+		}
+		for name := range u.changed {
+			cl := change.NewChangeList(nm.db, name).Load()
+			if cnt := len(cl.Changes()); len(cl.Truncate(h-1).Changes()) != cnt {
+				if err := cl.Save().Err(); err != nil {
+					return true, errors.Wrapf(err, "truncate %s", name)
+				}
+			}
+			if err := nm.dropSnapshots(name, h-1); err != nil {
+				return true, err
+			}
+		}
+		for key, p := range u.index {
+			var err error
+			if p.ok {
+				err = nm.idx.Put([]byte(key), p.val)
+			} else {
+				err = nm.idx.Delete([]byte(key))
+			}
+			if err != nil {
+				return true, errors.Wrapf(err, "restore index %x", key)
+			}
+		}
+		delete(nm.undos, h)
+	}
+	return true, nil
+}
@@ -0,0 +1,51 @@
+package claimtrie
+
+import (
+	"github.com/lbryio/claimtrie/change"
+	"github.com/lbryio/claimtrie/claim"
+
+	"github.com/pkg/errors"
+)
+
+// normalize prepares the name normalization fork, when the Head is right
+// before the fork height.
+//
+// Nodes whose names are changed by the normalization are merged into the
+// node of the normalized name, and emptied. The changes are made at the fork
+// height, so they are committed along with the changes of the fork block, and
+// the bidding of the merged nodes happens at the fork height.
+//
+// It's called whenever the Head is moved. Since the changes are pending until
+// the next commit, calling it again has no effect.
+func (ct *ClaimTrie) normalize() error {
+	if ct.Height() != ct.Params().NormalizedNameForkHeight-1 {
+		return nil
+	}
+	for _, name := range ct.nm.Names() {
+		normalized := claim.Normalize(name)
+		if normalized == name {
+			continue
+		}
+		n := ct.nm.NodeAt(name, ct.Height())
+		if len(n.Claims()) == 0 && len(n.Supports()) == 0 {
+			continue
+		}
+		chg := change.New(change.MergeNode).SetValue([]byte(name))
+		if err := ct.apply(normalized, chg); err != nil {
+			return errors.Wrapf(err, "merge %s into %s", name, normalized)
+		}
+		var chgs []*change.Change
+		for _, c := range n.Claims() {
+			chgs = append(chgs, change.New(change.SpendClaim).SetOP(c.OutPoint))
+		}
+		for _, s := range n.Supports() {
+			chgs = append(chgs, change.New(change.SpendSupport).SetOP(s.OutPoint))
+		}
+		for _, chg := range chgs {
+			if err := ct.apply(name, chg); err != nil {
+				return errors.Wrapf(err, "empty %s", name)
+			}
+		}
+	}
+	return nil
+}
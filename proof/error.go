@@ -0,0 +1,14 @@
+package proof
+
+import "fmt"
+
+var (
+	// ErrMalformed is returned when the Proof is not well-formed.
+	ErrMalformed = fmt.Errorf("malformed proof")
+
+	// ErrRootMismatch is returned when the root computed from the Proof doesn't match.
+	ErrRootMismatch = fmt.Errorf("root mismatch")
+
+	// ErrValueMismatch is returned when the Proof doesn't prove the specified value.
+	ErrValueMismatch = fmt.Errorf("value mismatch")
+)
@@ -0,0 +1,47 @@
+package proof
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+var (
+	// EmptyTrieHash represents the Merkle Hash of an empty Trie.
+	// "0000000000000000000000000000000000000000000000000000000000000001"
+	EmptyTrieHash = &chainhash.Hash{1}
+)
+
+// Proof proves the inclusion (or absence) of a key in a Trie with a specific MerkleHash.
+//
+// Nodes holds the nodes along the path of the Key, starting from the root.
+// The path ends early if the trie has no node for the remaining part of the Key.
+type Proof struct {
+	Key   []byte
+	Nodes []*Node
+
+	// Claim proves a claim among the active claims of the name, when the value
+	// of the name commits to all of them. It's nil when the value commits to
+	// the best claim only.
+	Claim *Branch
+}
+
+// Branch is the Merkle branch of a claim hash in the value hash of a node.
+//
+// Index is the position of the claim in the active claims ordered by bids,
+// and Hashes holds the siblings from the bottom of the Merkle tree up.
+type Branch struct {
+	Index  int
+	Hashes []*chainhash.Hash
+}
+
+// Node holds the entries of a trie node serialized by merkle(), except the
+// link to the next node in the Proof, which is recomputed by the verifier.
+type Node struct {
+	Links []Link
+	Value *chainhash.Hash
+}
+
+// Link is a (ch, hash) entry of a trie node.
+type Link struct {
+	Ch   byte
+	Hash *chainhash.Hash
+}
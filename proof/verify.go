@@ -0,0 +1,147 @@
+package proof
+
+import (
+	"bytes"
+
+	"github.com/lbryio/claimtrie/claim"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/pkg/errors"
+)
+
+// Verify verifies that the Proof proves the name is taken by the claim of op,
+// which tookover at the specified height, in the trie with the root hash.
+// If the Proof has a claim Branch, the claim of op can be any active claim of
+// the name, and tookover is the height at which the best claim tookover.
+func Verify(root *chainhash.Hash, name string, op claim.OutPoint, tookover claim.Height, p *Proof) error {
+	if err := verify(root, name, p); err != nil {
+		return err
+	}
+	d := len(p.Nodes) - 1
+	if d != len(name) || p.Nodes[d].Value == nil {
+		return errors.Wrapf(ErrValueMismatch, "name %s not found", name)
+	}
+	if c := p.Claim; c != nil && (c.Index < 0 || c.Index>>uint(len(c.Hashes)) != 0) {
+		return errors.Wrapf(ErrMalformed, "claim index %d", c.Index)
+	}
+	if *p.Nodes[d].Value != *p.Claim.value(claim.NodeHash(op, tookover)) {
+		return errors.Wrapf(ErrValueMismatch, "name %s", name)
+	}
+	return nil
+}
+
+// value returns the value hash computed from the claim hash h and the Branch.
+// A nil Branch returns h itself.
+func (b *Branch) value(h *chainhash.Hash) *chainhash.Hash {
+	if b == nil {
+		return h
+	}
+	i := b.Index
+	for _, sibling := range b.Hashes {
+		if i%2 == 0 {
+			h = claim.MerkleParent(h, sibling)
+		} else {
+			h = claim.MerkleParent(sibling, h)
+		}
+		i /= 2
+	}
+	return h
+}
+
+// VerifyAbsence verifies that the Proof proves the name doesn't exist in the trie with the root hash.
+func VerifyAbsence(root *chainhash.Hash, name string, p *Proof) error {
+	if err := verify(root, name, p); err != nil {
+		return err
+	}
+	if len(p.Nodes) == 0 {
+		return nil
+	}
+	d := len(p.Nodes) - 1
+	if d == len(name) {
+		if p.Nodes[d].Value != nil {
+			return errors.Wrapf(ErrValueMismatch, "name %s exists", name)
+		}
+		return nil
+	}
+	for _, l := range p.Nodes[d].Links {
+		if l.Ch == name[d] {
+			return errors.Wrapf(ErrMalformed, "path of %s continues at %d", name, d)
+		}
+	}
+	return nil
+}
+
+func verify(root *chainhash.Hash, name string, p *Proof) error {
+	if p == nil || !bytes.Equal(p.Key, []byte(name)) || len(p.Nodes) > len(name)+1 {
+		return ErrMalformed
+	}
+	h, err := p.root()
+	if err != nil {
+		return err
+	}
+	if root == nil || *h != *root {
+		return errors.Wrapf(ErrRootMismatch, "got %s, want %s", h, root)
+	}
+	return nil
+}
+
+// root recomputes the root hash of the Proof with the same rules of trie.merkle().
+func (p *Proof) root() (*chainhash.Hash, error) {
+	var h *chainhash.Hash
+	b := bytes.NewBuffer(nil)
+	for i := len(p.Nodes) - 1; i >= 0; i-- {
+		n := p.Nodes[i]
+		links := n.Links
+		if i < len(p.Nodes)-1 {
+			// The link along the path is taken from the next node.
+			for _, l := range links {
+				if l.Ch == p.Key[i] {
+					return nil, errors.Wrapf(ErrMalformed, "node %d links %q", i, l.Ch)
+				}
+			}
+		}
+		if h != nil {
+			links = insert(links, Link{Ch: p.Key[i], Hash: h})
+		}
+		b.Reset()
+		for j, l := range links {
+			if l.Hash == nil || (j > 0 && links[j-1].Ch >= l.Ch) {
+				return nil, errors.Wrapf(ErrMalformed, "links of node %d", i)
+			}
+			b.WriteByte(l.Ch)  // nolint : errchk
+			b.Write(l.Hash[:]) // nolint : errchk
+		}
+		if n.Value != nil {
+			b.Write(n.Value[:]) // nolint : errchk
+		}
+		// Only the root of an empty trie is empty.
+		if b.Len() == 0 && i > 0 {
+			return nil, errors.Wrapf(ErrMalformed, "node %d is empty", i)
+		}
+		h = nil
+		if b.Len() != 0 {
+			hh := chainhash.DoubleHashH(b.Bytes())
+			h = &hh
+		}
+	}
+	if h == nil {
+		return EmptyTrieHash, nil
+	}
+	return h, nil
+}
+
+// insert returns a copy of the links with l inserted in the order of Ch.
+func insert(links []Link, l Link) []Link {
+	ret := make([]Link, 0, len(links)+1)
+	for _, v := range links {
+		if l.Hash != nil && v.Ch > l.Ch {
+			ret = append(ret, l)
+			l.Hash = nil
+		}
+		ret = append(ret, v)
+	}
+	if l.Hash != nil {
+		ret = append(ret, l)
+	}
+	return ret
+}
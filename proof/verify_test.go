@@ -0,0 +1,96 @@
+package proof_test
+
+import (
+	"testing"
+
+	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/proof"
+	"github.com/lbryio/claimtrie/storage"
+	"github.com/lbryio/claimtrie/trie"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/pkg/errors"
+)
+
+type value struct {
+	h *chainhash.Hash
+}
+
+func (v value) Hash() *chainhash.Hash { return v.h }
+
+type values map[string]*chainhash.Hash
+
+func (m values) Get(key []byte) trie.Value { return value{m[string(key)]} }
+
+// newTrie returns a Trie of the names, taken by the claims at their indexes,
+// and its root hash.
+func newTrie(names ...string) (*trie.Trie, *chainhash.Hash) {
+	m := values{}
+	tr := trie.New(m, storage.NewMemDB())
+	for i, name := range names {
+		m[name] = claim.NodeHash(op(i), claim.Height(i))
+		tr.Update([]byte(name))
+	}
+	return tr, tr.MerkleHash()
+}
+
+func op(i int) claim.OutPoint {
+	return *claim.NewOutPoint(&chainhash.Hash{byte(i + 1)}, uint32(i))
+}
+
+func TestVerify(t *testing.T) {
+	names := []string{"a", "ab", "abc", "b", "hello", "help"}
+	tr, root := newTrie(names...)
+	for i, name := range names {
+		p, err := tr.Prove(root, []byte(name))
+		if err != nil {
+			t.Fatalf("Prove(%s): %s", name, err)
+		}
+		if err := proof.Verify(root, name, op(i), claim.Height(i), p); err != nil {
+			t.Errorf("Verify(%s): %s", name, err)
+		}
+		if err := proof.Verify(root, name, op(i), claim.Height(i+1), p); errors.Cause(err) != proof.ErrValueMismatch {
+			t.Errorf("Verify(%s) with wrong takeover: %v", name, err)
+		}
+		if err := proof.VerifyAbsence(root, name, p); err == nil {
+			t.Errorf("VerifyAbsence(%s) of an existing name succeeded", name)
+		}
+	}
+}
+
+func TestVerifyAbsence(t *testing.T) {
+	tr, root := newTrie("a", "ab", "abc", "b", "hello", "help")
+	for _, name := range []string{"", "abcd", "abd", "c", "he", "hel", "z"} {
+		p, err := tr.Prove(root, []byte(name))
+		if err != nil {
+			t.Fatalf("Prove(%s): %s", name, err)
+		}
+		if err := proof.VerifyAbsence(root, name, p); err != nil {
+			t.Errorf("VerifyAbsence(%s): %s", name, err)
+		}
+	}
+}
+
+func TestVerifyAbsenceForged(t *testing.T) {
+	tr, root := newTrie("a", "ab", "b")
+	// The root with all of its links, as proved for a name off the trie.
+	p, err := tr.Prove(root, []byte("z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := p.Nodes[0]
+	tests := []struct {
+		name  string
+		nodes []*proof.Node
+	}{
+		{"trailing empty node", []*proof.Node{full, {}}},
+		{"link along the path", []*proof.Node{full, {Value: full.Links[0].Hash}}},
+		{"path ends at a link", []*proof.Node{full}},
+	}
+	for _, tt := range tests {
+		forged := &proof.Proof{Key: []byte("ab"), Nodes: tt.nodes}
+		if err := proof.VerifyAbsence(root, "ab", forged); err == nil {
+			t.Errorf("%s: forged proof of absence accepted", tt.name)
+		}
+	}
+}
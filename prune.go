@@ -0,0 +1,86 @@
+package claimtrie
+
+import (
+	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/trie"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/pkg/errors"
+)
+
+// Pin pins the commit at height ht, so its trie is kept by Prune.
+// Unlike the commits, the pins are flushed to the database immediately.
+func (ct *ClaimTrie) Pin(ht claim.Height) error {
+	if err := ct.cm.Pin(ht); err != nil {
+		return err
+	}
+	return errors.Wrapf(ct.bufs[2].Flush(), "flush pin %d", ht)
+}
+
+// Unpin unpins the commit at height ht.
+func (ct *ClaimTrie) Unpin(ht claim.Height) error {
+	if err := ct.cm.Unpin(ht); err != nil {
+		return err
+	}
+	return errors.Wrapf(ct.bufs[2].Flush(), "flush unpin %d", ht)
+}
+
+// Pins returns the pinned heights, from the lowest one.
+func (ct *ClaimTrie) Pins() ([]claim.Height, error) {
+	return ct.cm.Pins()
+}
+
+// Prune removes the nodes from the trie database, which aren't reachable
+// from the roots of the latest depth commits, or the pinned ones. It returns
+// the number of nodes removed.
+//
+// The pruned commits can still be reset to, as their tries are rebuilt from
+// the node database, but they can't be proved or walked anymore.
+func (ct *ClaimTrie) Prune(depth int) (int, error) {
+	var roots []*chainhash.Hash
+	err := ct.cm.Log(ct.Height(), func(c *Commit) bool {
+		roots = append(roots, c.MerkleRoot)
+		return len(roots) >= depth
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "cm.Log()")
+	}
+	pins, err := ct.cm.Pins()
+	if err != nil {
+		return 0, err
+	}
+	for _, ht := range pins {
+		if ht > ct.Height() {
+			continue
+		}
+		c, err := ct.cm.At(ht)
+		if err != nil {
+			return 0, errors.Wrapf(err, "cm.At(%d)", ht)
+		}
+		roots = append(roots, c.MerkleRoot)
+	}
+	// The nodes written by MerkleHash() since the last commit are still
+	// buffered, and untouched by the sweep of the database.
+	n, err := trie.Prune(ct.bufs[0].Unwrap(), roots)
+	return n, errors.Wrapf(err, "trie.Prune()")
+}
+
+// restoreRoot rebuilds the trie of the Head commit from the nodes, if it
+// has been pruned from the trie database.
+func (ct *ClaimTrie) restoreRoot() error {
+	head := ct.Head()
+	if *head.MerkleRoot == *trie.EmptyTrieHash {
+		return nil
+	}
+	if ok, err := ct.bufs[0].Has(head.MerkleRoot[:]); err != nil || ok {
+		return errors.Wrapf(err, "db.Has(%s)", head.MerkleRoot)
+	}
+	tr := trie.New(ct.nm, ct.bufs[0])
+	for _, name := range ct.nm.Names() {
+		tr.Update([]byte(name))
+	}
+	if h := tr.MerkleHash(); *h != *head.MerkleRoot {
+		return errors.Wrapf(ErrInconsistent, "restored root %s, head %d has %s", h, head.Meta.Height, head.MerkleRoot)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package claimtrie
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/lbryio/claimtrie/claim"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+func TestPin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claimtrie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ct := openTestClaimTrie(t, dir)
+	roots := map[claim.Height]*chainhash.Hash{}
+	for ht := claim.Height(1); ht <= 20; ht++ {
+		op := *claim.NewOutPoint(&chainhash.Hash{byte(ht)}, 0)
+		if err := ct.AddClaim("name", op, claim.Amount(ht), nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := ct.Commit(ht); err != nil {
+			t.Fatal(err)
+		}
+		roots[ht] = ct.MerkleHash()
+	}
+	for _, ht := range []claim.Height{5, 10} {
+		if err := ct.Pin(ht); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ct.Unpin(10); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pins are written to the database without a commit.
+	if err := ct.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ct = openTestClaimTrie(t, dir)
+	defer ct.Close() // nolint : errchk
+	pins, err := ct.Pins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []claim.Height{5}; !reflect.DeepEqual(pins, want) {
+		t.Fatalf("pins %v, want %v", pins, want)
+	}
+	if _, err := ct.Prune(3); err != nil {
+		t.Fatal(err)
+	}
+	for ht, root := range roots {
+		_, err := ct.Trie().Prove(root, []byte("name"))
+		if kept := ht == 5 || ht > 17; kept != (err == nil) {
+			t.Errorf("root at %d: kept %t, err %v", ht, kept, err)
+		}
+	}
+}
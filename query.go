@@ -0,0 +1,169 @@
+package claimtrie
+
+import (
+	"strings"
+
+	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/resolve"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/pkg/errors"
+)
+
+// Result is a claim found by a query.
+// The queries of the ClaimTrie also see the changes that haven't been
+// committed, unlike the ones of a View.
+type Result struct {
+	// Name is the name of the node where the claim is, which is normalized
+	// after the normalization fork.
+	Name string
+
+	// Claim is a copy of the claim at the Height.
+	Claim *claim.Claim
+
+	// Height is the height at which the query is answered.
+	Height claim.Height
+
+	// Best tells whether the claim is the best claim of the name, which
+	// tookover at Tookover.
+	Best     bool
+	Tookover claim.Height
+}
+
+func newResult(n *claim.Node, c *claim.Claim) *Result {
+	dup := *c
+	best := n.BestClaim()
+	return &Result{
+		Name:     n.Name(),
+		Claim:    &dup,
+		Height:   n.Height(),
+		Best:     best != nil && best.OutPoint == c.OutPoint,
+		Tookover: n.Tookover(),
+	}
+}
+
+// ResolveName returns the best claim of the name at the Head.
+// The queries at earlier heights are answered by the View returned by At.
+func (ct *ClaimTrie) ResolveName(name string) (*Result, error) {
+	ht := ct.Height()
+	n := ct.nm.NodeAt(ct.Params().NormalizeName(name, ht), ht)
+	if n.BestClaim() == nil {
+		return nil, errors.Wrapf(ErrClaimNotFound, "name %s at %d", name, ht)
+	}
+	return newResult(n, n.BestClaim()), nil
+}
+
+// ResolveID returns the claim of the id at the Head, along with the name it's
+// under. The claim is looked up with the index.
+func (ct *ClaimTrie) ResolveID(id claim.ID) (*Result, error) {
+	ht := ct.Height()
+	if name, err := ct.nm.NameOf(id); err == nil {
+		n := ct.nm.NodeAt(name, ht)
+		if c := claim.Find(claim.ByID(id), n.Claims()); c != nil {
+			return newResult(n, c), nil
+		}
+	}
+	return nil, errors.Wrapf(ErrClaimNotFound, "id %s at %d", id, ht)
+}
+
+// ResolvePrefix returns the claim at the Head whose ID, in the hexadecimal
+// form, starts with the prefix. It returns ErrAmbiguousID if more than one
+// claim matches, and claim.ErrInvalidID if the prefix isn't a valid one.
+// The claims are looked up with the index.
+func (ct *ClaimTrie) ResolvePrefix(prefix string) (*Result, error) {
+	if err := claim.CheckIDPrefix(prefix); err != nil {
+		return nil, errors.Wrapf(err, "prefix %s", prefix)
+	}
+	prefix = strings.ToLower(prefix)
+	ids, err := ct.nm.IDsWithPrefix(prefix, 2)
+	switch {
+	case err != nil:
+		return nil, err
+	case len(ids) == 0:
+		return nil, errors.Wrapf(ErrClaimNotFound, "prefix %s at %d", prefix, ct.Height())
+	case len(ids) > 1:
+		return nil, errors.Wrapf(ErrAmbiguousID, "prefix %s matches %s and %s", prefix, ids[0], ids[1])
+	}
+	return ct.ResolveID(ids[0])
+}
+
+// ResolveURL resolves the LBRY URL, such as name#abc, name:3 or name$2, at
+// the Head.
+func (ct *ClaimTrie) ResolveURL(url string) (*resolve.Result, error) {
+	return resolve.New(ct.nm).Resolve(url, ct.Height())
+}
+
+// NameVisit visits a name. If it returns true, the iteration ends immediately.
+type NameVisit func(name string) (stop bool)
+
+// WalkNames visits the names in the range [start, end) in lexicographical
+// order. An empty end has no upper bound.
+// The names are read from the trie committed at the Head. Only the names
+// having a best claim are in the trie, and the changes not committed yet
+// aren't seen.
+func (ct *ClaimTrie) WalkNames(start, end string, visit NameVisit) error {
+	var last []byte
+	if end != "" {
+		last = []byte(end)
+	}
+	return ct.tr.Walk(ct.Head().MerkleRoot, []byte(start), last, func(key []byte, _ *chainhash.Hash) bool {
+		return visit(string(key))
+	})
+}
+
+// WalkPrefix visits the names starting with the prefix, such as "@" for the
+// channels, in lexicographical order. The prefix is normalized after the
+// normalization fork.
+// The names are read from the trie committed at the Head.
+func (ct *ClaimTrie) WalkPrefix(prefix string, visit NameVisit) error {
+	prefix = ct.Params().NormalizeName(prefix, ct.Height())
+	return ct.tr.WalkPrefix(ct.Head().MerkleRoot, []byte(prefix), func(key []byte, _ *chainhash.Hash) bool {
+		return visit(string(key))
+	})
+}
+
+// NameDiff visits a name whose value hash differs between two commits. The
+// from hash is nil if the name was added, and the to hash is nil if it was
+// removed. If it returns true, the diff ends immediately.
+type NameDiff func(name string, from, to *chainhash.Hash) (stop bool)
+
+// Diff visits the names whose value hashes differ between the tries committed
+// at the heights, in lexicographical order.
+// It works either way, and only reads the subtrees that differ.
+func (ct *ClaimTrie) Diff(from, to claim.Height, visit NameDiff) error {
+	var roots [2]*chainhash.Hash
+	for i, ht := range []claim.Height{from, to} {
+		if err := ct.checkHeight(ht); err != nil {
+			return err
+		}
+		c, err := ct.cm.At(ht)
+		if err != nil {
+			return err
+		}
+		roots[i] = c.MerkleRoot
+	}
+	return ct.tr.Diff(roots[0], roots[1], func(key []byte, from, to *chainhash.Hash) bool {
+		return visit(string(key), from, to)
+	})
+}
+
+// checkHeight returns ErrInvalidHeight if height ht isn't committed yet.
+func (ct *ClaimTrie) checkHeight(ht claim.Height) error {
+	if ht < 0 || ht > ct.Height() {
+		return errors.Wrapf(ErrInvalidHeight, "query at %d, head at %d", ht, ct.Height())
+	}
+	return nil
+}
+
+// visitClaims visits the claims of the nodes of the names, until the visit
+// returns true.
+func visitClaims(names []string, node func(name string) *claim.Node, visit func(n *claim.Node, c *claim.Claim) bool) {
+	for _, name := range names {
+		n := node(name)
+		for _, c := range n.Claims() {
+			if visit(n, c) {
+				return
+			}
+		}
+	}
+}
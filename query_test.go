@@ -0,0 +1,68 @@
+package claimtrie
+
+import (
+	"testing"
+
+	"github.com/lbryio/claimtrie/cfg"
+	"github.com/lbryio/claimtrie/claim"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/pkg/errors"
+)
+
+// newTestClaimTrie returns an in-memory ClaimTrie with the regtest params.
+func newTestClaimTrie(t *testing.T) *ClaimTrie {
+	c := cfg.DefaultConfig()
+	c.InMemory = true
+	c.Params = claim.RegTestParams
+	c.Logger = nil
+	ct, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ct
+}
+
+func TestResolvePrefixInvalid(t *testing.T) {
+	ct := newTestClaimTrie(t)
+	for i := 0; i < 32; i++ {
+		op := *claim.NewOutPoint(&chainhash.Hash{byte(i)}, 0)
+		if err := ct.AddClaim("name", op, 1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for ht := claim.Height(1); ht <= 2; ht++ {
+		if err := ct.Commit(ht); err != nil {
+			t.Fatal(err)
+		}
+	}
+	v, err := ct.At(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The Head is answered with the index, and the earlier height by a scan.
+	resolvers := map[string]func(string) (*Result, error){
+		"head": ct.ResolvePrefix,
+		"view": v.ResolvePrefix,
+	}
+	tooLong := "0123456789012345678901234567890123456789a"
+	id := claim.NewID(*claim.NewOutPoint(&chainhash.Hash{0}, 0)).String()
+	for at, resolvePrefix := range resolvers {
+		for _, prefix := range []string{"zz", "f-", "0x", tooLong} {
+			if _, err := resolvePrefix(prefix); errors.Cause(err) != claim.ErrInvalidID {
+				t.Errorf("ResolvePrefix(%s) at %s: %v", prefix, at, err)
+			}
+		}
+		res, err := resolvePrefix(id[:12])
+		if err != nil || res.Claim.ID.String() != id {
+			t.Errorf("ResolvePrefix(%s) at %s: %v", id[:12], at, err)
+		}
+	}
+}
+
+func TestResolveURLNotFound(t *testing.T) {
+	ct := newTestClaimTrie(t)
+	if _, err := ct.ResolveURL("name$1"); errors.Cause(err) != ErrClaimNotFound {
+		t.Errorf("ResolveURL(name$1): %v", err)
+	}
+}
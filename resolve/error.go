@@ -0,0 +1,8 @@
+package resolve
+
+import "fmt"
+
+var (
+	// ErrInvalidURL is returned when the URL can't be parsed.
+	ErrInvalidURL = fmt.Errorf("invalid URL")
+)
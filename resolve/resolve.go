@@ -0,0 +1,125 @@
+package resolve
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/lbryio/claimtrie/claim"
+
+	"github.com/pkg/errors"
+)
+
+// Result is the claim resolved from a URL.
+type Result struct {
+	// Name is the name of the node where the claim is, which is normalized
+	// after the normalization fork.
+	Name string
+
+	// Claim is a copy of the claim at the Height. Its Accepted and ActiveAt
+	// tell when the claim was accepted, and when it becomes active.
+	Claim claim.Claim
+
+	// Height is the height at which the URL is resolved.
+	Height claim.Height
+
+	// Active tells whether the Claim is active at the Height.
+	Active bool
+
+	// Rank is the 1-based position of the Claim among the active claims
+	// ordered by effective amount. It's 0 if the Claim is not active.
+	Rank int
+
+	// Best tells whether the Claim is the best claim of the name, which
+	// tookover at Tookover.
+	Best     bool
+	Tookover claim.Height
+}
+
+// Nodes provides the nodes at the heights, such as a NodeMgr.
+type Nodes interface {
+	Params() *claim.Params
+	NodeAt(name string, ht claim.Height) *claim.Node
+}
+
+// Resolver resolves LBRY URLs with the nodes of a NodeMgr, or other Nodes.
+type Resolver struct {
+	nm Nodes
+}
+
+// New returns a Resolver which reads the nodes from nm.
+func New(nm Nodes) *Resolver {
+	return &Resolver{nm: nm}
+}
+
+// Resolve parses the URL, and resolves it at height ht.
+func (r *Resolver) Resolve(url string, ht claim.Height) (*Result, error) {
+	u, err := Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	return r.ResolveURL(u, ht)
+}
+
+// ResolveURL resolves the URL at height ht.
+//
+// With the ClaimID modifier, the earliest created claim matching the prefix
+// is picked. The Sequence modifier counts the claims of the name at height
+// ht, from the earliest created one. Claims created at the same height are
+// ordered by their IDs.
+// It returns claim.ErrClaimNotFound if no claim matches the URL.
+func (r *Resolver) ResolveURL(u *URL, ht claim.Height) (*Result, error) {
+	name := r.nm.Params().NormalizeName(u.Name, ht)
+	n := r.nm.NodeAt(name, ht)
+	ranked := n.ActiveClaims()
+
+	var c *claim.Claim
+	switch u.Modifier {
+	case Winning:
+		c = n.BestClaim()
+	case AmountOrder:
+		if u.N <= len(ranked) {
+			c = ranked[u.N-1]
+		}
+	case Sequence:
+		if l := byCreation(n.Claims()); u.N <= len(l) {
+			c = l[u.N-1]
+		}
+	case ClaimID:
+		for _, v := range byCreation(n.Claims()) {
+			if strings.HasPrefix(v.ID.String(), u.ClaimID) {
+				c = v
+				break
+			}
+		}
+	}
+	if c == nil {
+		return nil, errors.Wrapf(claim.ErrClaimNotFound, "%s at %d", u, ht)
+	}
+
+	res := &Result{
+		Name:     name,
+		Claim:    *c,
+		Height:   n.Height(),
+		Active:   n.Params().IsActiveAt(c, n.Height()),
+		Best:     c == n.BestClaim(),
+		Tookover: n.Tookover(),
+	}
+	for i, v := range ranked {
+		if v == c {
+			res.Rank = i + 1
+		}
+	}
+	return res, nil
+}
+
+// byCreation returns a copy of the list ordered by the creation of the claims.
+func byCreation(l claim.List) claim.List {
+	l = append(claim.List(nil), l...)
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].Created != l[j].Created {
+			return l[i].Created < l[j].Created
+		}
+		return l[i].ID.String() < l[j].ID.String()
+	})
+	return l
+}
@@ -0,0 +1,93 @@
+package resolve
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lbryio/claimtrie/claim"
+
+	"github.com/pkg/errors"
+)
+
+// Modifier specifies how a claim is picked among the claims of a name.
+type Modifier int
+
+// ...
+const (
+	// Winning picks the best claim of the name.
+	Winning Modifier = iota
+
+	// ClaimID picks the claim whose ID starts with the ID prefix. (name#abc)
+	ClaimID
+
+	// Sequence picks the Nth claim by the order of creation. (name:3)
+	Sequence
+
+	// AmountOrder picks the Nth claim by effective amount. (name$2)
+	AmountOrder
+)
+
+// Scheme is the optional scheme of a LBRY URL.
+const Scheme = "lbry://"
+
+// URL is a parsed LBRY URL.
+type URL struct {
+	Name     string
+	Modifier Modifier
+
+	// ClaimID holds the claim ID prefix for the ClaimID modifier, in the
+	// hexadecimal form.
+	ClaimID string
+
+	// N holds the 1-based position for the Sequence and AmountOrder modifiers.
+	N int
+}
+
+// Parse parses a LBRY URL, which is a name with at most one modifier.
+func Parse(s string) (*URL, error) {
+	s = strings.TrimPrefix(s, Scheme)
+	i := strings.IndexAny(s, "#:$")
+	if i < 0 {
+		if s == "" {
+			return nil, errors.Wrapf(ErrInvalidURL, "empty name")
+		}
+		return &URL{Name: s}, nil
+	}
+	u := &URL{Name: s[:i]}
+	val := s[i+1:]
+	if u.Name == "" || val == "" || strings.ContainsAny(val, "#:$") {
+		return nil, errors.Wrapf(ErrInvalidURL, "%s", s)
+	}
+	switch s[i] {
+	case '#':
+		if err := claim.CheckIDPrefix(val); err != nil {
+			return nil, errors.Wrapf(ErrInvalidURL, "claim ID %s", val)
+		}
+		u.Modifier = ClaimID
+		u.ClaimID = strings.ToLower(val)
+		return u, nil
+	case ':':
+		u.Modifier = Sequence
+	default:
+		u.Modifier = AmountOrder
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 1 {
+		return nil, errors.Wrapf(ErrInvalidURL, "position %s", val)
+	}
+	u.N = n
+	return u, nil
+}
+
+// String returns the URL in the canonical form, without the scheme.
+func (u *URL) String() string {
+	switch u.Modifier {
+	case ClaimID:
+		return u.Name + "#" + u.ClaimID
+	case Sequence:
+		return u.Name + ":" + strconv.Itoa(u.N)
+	case AmountOrder:
+		return u.Name + "$" + strconv.Itoa(u.N)
+	}
+	return u.Name
+}
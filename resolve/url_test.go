@@ -0,0 +1,19 @@
+package resolve
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestParseClaimID(t *testing.T) {
+	for _, s := range []string{"name#0x", "name#ab-c", "name#0123456789012345678901234567890123456789a"} {
+		if _, err := Parse(s); errors.Cause(err) != ErrInvalidURL {
+			t.Errorf("Parse(%s): %v", s, err)
+		}
+	}
+	u, err := Parse("lbry://name#AbC")
+	if err != nil || u.Modifier != ClaimID || u.ClaimID != "abc" {
+		t.Errorf("Parse(lbry://name#AbC): %v, %v", u, err)
+	}
+}
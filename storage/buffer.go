@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+type entry struct {
+	value []byte
+	del   bool
+}
+
+// Buffer is a DB which keeps the writes in memory until they are flushed to
+// the underlying DB. Reads see the pending writes on top of the underlying DB.
+type Buffer struct {
+	sync.RWMutex
+	db      DB
+	pending map[string]entry
+}
+
+// NewBuffer returns a Buffer on top of db.
+func NewBuffer(db DB) *Buffer {
+	return &Buffer{db: db, pending: map[string]entry{}}
+}
+
+// Get ...
+func (b *Buffer) Get(key []byte) ([]byte, error) {
+	b.RLock()
+	e, ok := b.pending[string(key)]
+	b.RUnlock()
+	if !ok {
+		return b.db.Get(key)
+	}
+	if e.del {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), e.value...), nil
+}
+
+// Has ...
+func (b *Buffer) Has(key []byte) (bool, error) {
+	b.RLock()
+	e, ok := b.pending[string(key)]
+	b.RUnlock()
+	if !ok {
+		return b.db.Has(key)
+	}
+	return !e.del, nil
+}
+
+// Put ...
+func (b *Buffer) Put(key, value []byte) error {
+	b.Lock()
+	defer b.Unlock()
+	b.pending[string(key)] = entry{value: append([]byte(nil), value...)}
+	return nil
+}
+
+// Delete ...
+func (b *Buffer) Delete(key []byte) error {
+	b.Lock()
+	defer b.Unlock()
+	b.pending[string(key)] = entry{del: true}
+	return nil
+}
+
+// Write ...
+func (b *Buffer) Write(batch *Batch) error {
+	b.Lock()
+	defer b.Unlock()
+	for _, o := range batch.Ops {
+		b.pending[string(o.Key)] = entry{value: o.Value, del: o.Delete}
+	}
+	return nil
+}
+
+// NewIterator returns an Iterator which merges a snapshot of the pending
+// writes with the underlying DB.
+func (b *Buffer) NewIterator(prefix []byte) Iterator {
+	b.RLock()
+	defer b.RUnlock()
+	it := &bufferIterator{it: b.db.NewIterator(prefix)}
+	for k := range b.pending {
+		if strings.HasPrefix(k, string(prefix)) {
+			it.keys = append(it.keys, k)
+		}
+	}
+	sort.Strings(it.keys)
+	for _, k := range it.keys {
+		it.ents = append(it.ents, b.pending[k])
+	}
+	return it
+}
+
+// Close closes the underlying DB. The pending writes are discarded.
+func (b *Buffer) Close() error {
+	b.Discard()
+	return b.db.Close()
+}
+
+// Pending returns the pending writes as a Batch in the order of keys.
+func (b *Buffer) Pending() *Batch {
+	b.RLock()
+	defer b.RUnlock()
+	keys := make([]string, 0, len(b.pending))
+	for k := range b.pending {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	batch := &Batch{}
+	for _, k := range keys {
+		e := b.pending[k]
+		batch.Ops = append(batch.Ops, Op{Key: []byte(k), Value: e.value, Delete: e.del})
+	}
+	return batch
+}
+
+// Flush writes the pending writes to the underlying DB atomically.
+func (b *Buffer) Flush() error {
+	batch := b.Pending()
+	if batch.Len() == 0 {
+		return nil
+	}
+	if err := b.db.Write(batch); err != nil {
+		return err
+	}
+	b.Discard()
+	return nil
+}
+
+// Discard drops the pending writes.
+func (b *Buffer) Discard() {
+	b.Lock()
+	defer b.Unlock()
+	b.pending = map[string]entry{}
+}
+
+// Unwrap returns the underlying DB.
+func (b *Buffer) Unwrap() DB {
+	return b.db
+}
+
+type bufferIterator struct {
+	it      Iterator
+	started bool
+	valid   bool
+
+	keys []string
+	ents []entry
+	pos  int
+
+	key   []byte
+	value []byte
+}
+
+func (it *bufferIterator) Next() bool {
+	if !it.started {
+		it.valid = it.it.Next()
+		it.started = true
+	}
+	for {
+		hasPending := it.pos < len(it.keys)
+		if !it.valid && !hasPending {
+			it.key, it.value = nil, nil
+			return false
+		}
+		if hasPending && (!it.valid || it.keys[it.pos] <= string(it.it.Key())) {
+			k, e := it.keys[it.pos], it.ents[it.pos]
+			it.pos++
+			if it.valid && k == string(it.it.Key()) {
+				it.valid = it.it.Next()
+			}
+			if e.del {
+				continue
+			}
+			// The pending values are copied, as Get does, so the caller can't
+			// alias the Buffer.
+			it.key, it.value = []byte(k), append([]byte(nil), e.value...)
+			return true
+		}
+		it.key = append([]byte(nil), it.it.Key()...)
+		it.value = append([]byte(nil), it.it.Value()...)
+		it.valid = it.it.Next()
+		return true
+	}
+}
+
+func (it *bufferIterator) Key() []byte   { return it.key }
+func (it *bufferIterator) Value() []byte { return it.value }
+func (it *bufferIterator) Error() error  { return it.it.Error() }
+
+func (it *bufferIterator) Release() {
+	it.it.Release()
+	it.keys, it.ents = nil, nil
+}
@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBufferIteratorCopies(t *testing.T) {
+	b := NewBuffer(NewMemDB())
+	if err := b.Put([]byte("k"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	iter := b.NewIterator(nil)
+	if !iter.Next() {
+		t.Fatal("pending entry not visited")
+	}
+	iter.Value()[0] = 'x'
+	iter.Release()
+	if v, err := b.Get([]byte("k")); err != nil || !bytes.Equal(v, []byte("v")) {
+		t.Fatalf("pending value %q, %v after the iterated one changed", v, err)
+	}
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+type levelDB struct {
+	db *leveldb.DB
+}
+
+// OpenLevelDB opens (or creates) a leveldb backed DB at path.
+func OpenLevelDB(path string, o *opt.Options) (DB, error) {
+	db, err := leveldb.OpenFile(path, o)
+	if err != nil {
+		return nil, err
+	}
+	return &levelDB{db: db}, nil
+}
+
+func (l *levelDB) Get(key []byte) ([]byte, error) {
+	v, err := l.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return v, err
+}
+
+func (l *levelDB) Has(key []byte) (bool, error) {
+	return l.db.Has(key, nil)
+}
+
+func (l *levelDB) Put(key, value []byte) error {
+	return l.db.Put(key, value, nil)
+}
+
+func (l *levelDB) Delete(key []byte) error {
+	return l.db.Delete(key, nil)
+}
+
+func (l *levelDB) Write(b *Batch) error {
+	lb := &leveldb.Batch{}
+	for _, o := range b.Ops {
+		if o.Delete {
+			lb.Delete(o.Key)
+			continue
+		}
+		lb.Put(o.Key, o.Value)
+	}
+	return l.db.Write(lb, nil)
+}
+
+func (l *levelDB) NewIterator(prefix []byte) Iterator {
+	return l.db.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+func (l *levelDB) Close() error {
+	return l.db.Close()
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+type memDB struct {
+	sync.RWMutex
+	kvs map[string][]byte
+}
+
+// NewMemDB returns a DB kept entirely in memory.
+// The content is lost once the DB is released.
+func NewMemDB() DB {
+	return &memDB{kvs: map[string][]byte{}}
+}
+
+func (m *memDB) Get(key []byte) ([]byte, error) {
+	m.RLock()
+	defer m.RUnlock()
+	v, ok := m.kvs[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), v...), nil
+}
+
+func (m *memDB) Has(key []byte) (bool, error) {
+	m.RLock()
+	defer m.RUnlock()
+	_, ok := m.kvs[string(key)]
+	return ok, nil
+}
+
+func (m *memDB) Put(key, value []byte) error {
+	m.Lock()
+	defer m.Unlock()
+	m.kvs[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *memDB) Delete(key []byte) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.kvs, string(key))
+	return nil
+}
+
+func (m *memDB) Write(b *Batch) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, o := range b.Ops {
+		if o.Delete {
+			delete(m.kvs, string(o.Key))
+			continue
+		}
+		m.kvs[string(o.Key)] = o.Value
+	}
+	return nil
+}
+
+// NewIterator returns an Iterator over a snapshot of the keys with the prefix.
+func (m *memDB) NewIterator(prefix []byte) Iterator {
+	m.RLock()
+	defer m.RUnlock()
+	it := &memIterator{pos: -1}
+	for k, v := range m.kvs {
+		if strings.HasPrefix(k, string(prefix)) {
+			it.keys = append(it.keys, k)
+			it.values = append(it.values, v)
+		}
+	}
+	sort.Sort(it)
+	return it
+}
+
+func (m *memDB) Close() error {
+	return nil
+}
+
+type memIterator struct {
+	keys   []string
+	values [][]byte
+	pos    int
+}
+
+func (it *memIterator) Len() int           { return len(it.keys) }
+func (it *memIterator) Less(i, j int) bool { return it.keys[i] < it.keys[j] }
+func (it *memIterator) Swap(i, j int) {
+	it.keys[i], it.keys[j] = it.keys[j], it.keys[i]
+	it.values[i], it.values[j] = it.values[j], it.values[i]
+}
+
+func (it *memIterator) Next() bool {
+	if it.pos < len(it.keys) {
+		it.pos++
+	}
+	return it.pos < len(it.keys)
+}
+
+func (it *memIterator) Key() []byte {
+	if it.pos < 0 || it.pos >= len(it.keys) {
+		return nil
+	}
+	return []byte(it.keys[it.pos])
+}
+
+func (it *memIterator) Value() []byte {
+	if it.pos < 0 || it.pos >= len(it.keys) {
+		return nil
+	}
+	return it.values[it.pos]
+}
+
+func (it *memIterator) Release() {
+	it.keys, it.values = nil, nil
+}
+
+func (it *memIterator) Error() error {
+	return nil
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned when the key is not found in the DB.
+	ErrNotFound = fmt.Errorf("not found")
+)
+
+// DB is the key-value store which the ClaimTrie keeps its states in.
+type DB interface {
+	// Get returns the value of the key, or ErrNotFound if the key doesn't exist.
+	Get(key []byte) ([]byte, error)
+	Has(key []byte) (bool, error)
+	Put(key, value []byte) error
+	Delete(key []byte) error
+
+	// Write applies the Batch atomically.
+	Write(b *Batch) error
+
+	// NewIterator returns an Iterator over the keys with the prefix in lexicographical order.
+	NewIterator(prefix []byte) Iterator
+
+	Close() error
+}
+
+// Iterator iterates over key/value pairs of a DB.
+// The Iterator must be released after use.
+type Iterator interface {
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Release()
+	Error() error
+}
+
+// Op is a write operation in a Batch.
+type Op struct {
+	Key    []byte
+	Value  []byte
+	Delete bool
+}
+
+// Batch is a sequence of writes to be applied to a DB atomically.
+// The Ops are exported so a Batch can be serialized, e.g. into a write-ahead log.
+type Batch struct {
+	Ops []Op
+}
+
+// Put appends a put operation to the Batch.
+// The key and value are copied, so the caller can reuse them.
+func (b *Batch) Put(key, value []byte) {
+	key, value = append([]byte(nil), key...), append([]byte(nil), value...)
+	b.Ops = append(b.Ops, Op{Key: key, Value: value})
+}
+
+// Delete appends a delete operation to the Batch.
+func (b *Batch) Delete(key []byte) {
+	b.Ops = append(b.Ops, Op{Key: append([]byte(nil), key...), Delete: true})
+}
+
+// Len returns the number of operations in the Batch.
+func (b *Batch) Len() int {
+	return len(b.Ops)
+}
+
+// Reset clears the operations in the Batch.
+func (b *Batch) Reset() {
+	b.Ops = b.Ops[:0]
+}
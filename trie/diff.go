@@ -0,0 +1,80 @@
+package trie
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// DiffFunc visits a key whose value hash differs between two Tries. The from
+// hash is nil if the key was added, and the to hash is nil if it was removed.
+// If it returns true, the diff ends immediately.
+type DiffFunc func(key []byte, from, to *chainhash.Hash) (stop bool)
+
+// Diff visits the keys whose value hashes differ between the Tries with the
+// specified root hashes, in lexicographical order. The subtrees with equal
+// hashes are skipped, so the cost is bound by the size of the difference.
+// The nodes are read from the database, so the roots have to be produced by
+// MerkleHash().
+func (t *Trie) Diff(from, to *chainhash.Hash, visit DiffFunc) error {
+	_, err := t.diff(emptyRoot(from), emptyRoot(to), make([]byte, 0, 64), visit)
+	return err
+}
+
+// emptyRoot returns nil for the root of an empty Trie.
+func emptyRoot(h *chainhash.Hash) *chainhash.Hash {
+	if h == nil || *h == *EmptyTrieHash {
+		return nil
+	}
+	return h
+}
+
+func (t *Trie) diff(from, to *chainhash.Hash, key []byte, visit DiffFunc) (bool, error) {
+	if from == nil && to == nil || from != nil && to != nil && *from == *to {
+		return false, nil
+	}
+	var a, b nbuf
+	var err error
+	if from != nil {
+		if a, err = t.nbuf(from); err != nil {
+			return false, err
+		}
+	}
+	if to != nil {
+		if b, err = t.nbuf(to); err != nil {
+			return false, err
+		}
+	}
+	if va, vb := a.value(), b.value(); va != nil || vb != nil {
+		if va == nil || vb == nil || *va != *vb {
+			if visit(append([]byte(nil), key...), va, vb) {
+				return true, nil
+			}
+		}
+	}
+	// Merge the links of both nodes, which are in the order of their bytes.
+	for i, j := 0, 0; i < a.entries() || j < b.entries(); {
+		var cha, chb byte
+		var ha, hb *chainhash.Hash
+		if i < a.entries() {
+			cha, ha = a.entry(i)
+		}
+		if j < b.entries() {
+			chb, hb = b.entry(j)
+		}
+		ch := cha
+		switch {
+		case hb == nil || ha != nil && cha < chb:
+			hb = nil
+			i++
+		case ha == nil || chb < cha:
+			ha, ch = nil, chb
+			j++
+		default:
+			i++
+			j++
+		}
+		if stop, err := t.diff(ha, hb, append(key, ch), visit); stop || err != nil {
+			return stop, err
+		}
+	}
+	return false, nil
+}
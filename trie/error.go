@@ -0,0 +1,8 @@
+package trie
+
+import "fmt"
+
+var (
+	// ErrMissingNode is returned when a node referenced by a hash is not in the database.
+	ErrMissingNode = fmt.Errorf("missing node")
+)
@@ -10,6 +10,7 @@ type Value interface {
 }
 
 // KeyValue ...
+// The Get is called concurrently when the Trie hashes with more than one worker.
 type KeyValue interface {
 	Get(key []byte) Value
 }
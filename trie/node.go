@@ -4,9 +4,16 @@ import (
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
+// node is a path-compressed node in memory. It stands for a chain of nodes
+// on disk, one for each byte of its path, which have a single link and no
+// value. The chain ends with the node holding the links and the value.
+//
+// The hash is the one of the first node in the chain, as linked by the
+// parent. It's nil if the node is dirty.
 type node struct {
 	hash     *chainhash.Hash
-	links    [256]*node
+	path     []byte
+	links    map[byte]*node
 	hasValue bool
 }
 
@@ -14,6 +21,28 @@ func newNode() *node {
 	return &node{}
 }
 
+// link returns the child linked by ch, creating it if missing.
+func (n *node) link(ch byte) *node {
+	if c := n.links[ch]; c != nil {
+		return c
+	}
+	if n.links == nil {
+		n.links = map[byte]*node{}
+	}
+	c := newNode()
+	n.links[ch] = c
+	return c
+}
+
+// split cuts the path of the node at i, and moves the rest of the chain to a
+// new child. The child is left dirty, so its hash is recalculated.
+func (n *node) split(i int) {
+	c := &node{path: n.path[i+1:], links: n.links, hasValue: n.hasValue}
+	n.links = map[byte]*node{n.path[i]: c}
+	n.path = n.path[:i]
+	n.hasValue = false
+}
+
 // nbuf decodes the on-disk format of a node, which has the following form:
 //   ch(1B) hash(32B)
 //   ...
@@ -34,3 +63,12 @@ func (nb nbuf) entry(i int) (byte, *chainhash.Hash) {
 func (nb nbuf) hasValue() bool {
 	return len(nb)%33 == 32
 }
+
+func (nb nbuf) value() *chainhash.Hash {
+	if !nb.hasValue() {
+		return nil
+	}
+	h := chainhash.Hash{}
+	copy(h[:], nb[len(nb)-32:])
+	return &h
+}
@@ -0,0 +1,40 @@
+package trie
+
+import (
+	"github.com/lbryio/claimtrie/proof"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// Prove returns a Proof of the key against the Trie with specified root hash.
+// The nodes are read from the database, so the root has to be produced by MerkleHash().
+func (t *Trie) Prove(root *chainhash.Hash, key []byte) (*proof.Proof, error) {
+	p := &proof.Proof{Key: key}
+	if root == nil || *root == *EmptyTrieHash {
+		return p, nil
+	}
+	h := root
+	for i := 0; i <= len(key); i++ {
+		nb, err := t.nbuf(h)
+		if err != nil {
+			return nil, err
+		}
+		pn := &proof.Node{Value: nb.value()}
+		p.Nodes = append(p.Nodes, pn)
+
+		var next *chainhash.Hash
+		for j := 0; j < nb.entries(); j++ {
+			ch, lh := nb.entry(j)
+			if i < len(key) && ch == key[i] {
+				next = lh
+				continue
+			}
+			pn.Links = append(pn.Links, proof.Link{Ch: ch, Hash: lh})
+		}
+		if next == nil {
+			break
+		}
+		h = next
+	}
+	return p, nil
+}
@@ -0,0 +1,89 @@
+package trie
+
+import (
+	"github.com/lbryio/claimtrie/storage"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/pkg/errors"
+)
+
+// pruneBatch is the number of deletes written to the database at once.
+const pruneBatch = 4096
+
+// Prune removes the nodes which aren't reachable from any of the roots from
+// db, and returns the number of nodes removed.
+//
+// The reachable nodes are marked first, and nothing is removed if any of them
+// is missing. The nodes are then swept in batches, so an interrupted Prune
+// leaves the database consistent, and can simply be run again.
+func Prune(db storage.DB, roots []*chainhash.Hash) (int, error) {
+	marked, err := mark(db, roots)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	batch := &storage.Batch{}
+	write := func() error {
+		if err := db.Write(batch); err != nil {
+			return errors.Wrapf(err, "db.Write()")
+		}
+		removed += batch.Len()
+		batch.Reset()
+		return nil
+	}
+	iter := db.NewIterator(nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != chainhash.HashSize {
+			continue
+		}
+		var h chainhash.Hash
+		copy(h[:], key)
+		if marked[h] {
+			continue
+		}
+		if batch.Delete(h[:]); batch.Len() >= pruneBatch {
+			if err := write(); err != nil {
+				return removed, err
+			}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return removed, errors.Wrapf(err, "iterate nodes")
+	}
+	return removed, write()
+}
+
+// mark returns the hashes of the nodes reachable from the roots.
+// The subtrees shared by the roots are visited once.
+func mark(db storage.DB, roots []*chainhash.Hash) (map[chainhash.Hash]bool, error) {
+	marked := map[chainhash.Hash]bool{}
+	var stack []*chainhash.Hash
+	for _, h := range roots {
+		if h != nil && *h != *EmptyTrieHash {
+			stack = append(stack, h)
+		}
+	}
+	for len(stack) > 0 {
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if marked[*h] {
+			continue
+		}
+		b, err := db.Get(h[:])
+		if err == storage.ErrNotFound {
+			return nil, errors.Wrapf(ErrMissingNode, "node %s", h)
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "db.Get(%s)", h)
+		}
+		marked[*h] = true
+		nb := nbuf(b)
+		for i := 0; i < nb.entries(); i++ {
+			if _, lh := nb.entry(i); !marked[*lh] {
+				stack = append(stack, lh)
+			}
+		}
+	}
+	return marked, nil
+}
@@ -2,31 +2,39 @@ package trie
 
 import (
 	"bytes"
+	"runtime"
 	"sync"
 
+	"github.com/lbryio/claimtrie/proof"
+	"github.com/lbryio/claimtrie/storage"
+
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
-	"github.com/syndtr/goleveldb/leveldb"
 )
 
 var (
 	// EmptyTrieHash represents the Merkle Hash of an empty Trie.
-	// "0000000000000000000000000000000000000000000000000000000000000001"
-	EmptyTrieHash = &chainhash.Hash{1}
+	EmptyTrieHash = proof.EmptyTrieHash
 )
 
-// Trie implements a 256-way prefix tree.
+// Trie implements a 256-way prefix tree, which is path-compressed in memory.
 type Trie struct {
 	kv KeyValue
-	db *leveldb.DB
+	db storage.DB
 
 	root  *node
 	bufs  *sync.Pool
-	batch *leveldb.Batch
+	batch *storage.Batch
+
+	// batchmu synchronizes the writes to the batch by the workers, which
+	// hash the dirty subtrees concurrently. Each token of the workers allows
+	// one more goroutine besides the caller of MerkleHash().
+	batchmu sync.Mutex
+	workers chan struct{}
 }
 
-// New returns a Trie.
-func New(kv KeyValue, db *leveldb.DB) *Trie {
-	return &Trie{
+// New returns a Trie, which hashes with as many workers as the CPUs.
+func New(kv KeyValue, db storage.DB) *Trie {
+	t := &Trie{
 		kv:   kv,
 		db:   db,
 		root: newNode(),
@@ -36,6 +44,18 @@ func New(kv KeyValue, db *leveldb.DB) *Trie {
 			},
 		},
 	}
+	t.SetWorkers(runtime.NumCPU())
+	return t
+}
+
+// SetWorkers sets the number of workers hashing the dirty subtrees
+// concurrently. One worker hashes the whole Trie sequentially.
+// The KeyValue has to be safe for concurrent use with more than one worker.
+func (t *Trie) SetWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	t.workers = make(chan struct{}, n-1)
 }
 
 // SetRoot drops all resolved nodes in the Trie, and set the root with specified hash.
@@ -45,52 +65,78 @@ func (t *Trie) SetRoot(h *chainhash.Hash) {
 }
 
 // Update updates the nodes along the path to the key.
-// Each node is resolved or created with their Hash cleared.
+// Each node is resolved or created with their Hash cleared. The path of a
+// node is split where the key leaves it, and a new node takes the rest of
+// the key as its path.
 func (t *Trie) Update(key []byte) {
 	n := t.root
-	for _, ch := range key {
+	for {
 		t.resolve(n)
-		if n.links[ch] == nil {
-			n.links[ch] = newNode()
+		i := 0
+		for i < len(n.path) && i < len(key) && n.path[i] == key[i] {
+			i++
+		}
+		if i < len(n.path) {
+			n.split(i)
 		}
 		n.hash = nil
-		n = n.links[ch]
+		if key = key[i:]; len(key) == 0 {
+			break
+		}
+		if n.links[key[0]] == nil {
+			c := n.link(key[0])
+			c.path = append([]byte(nil), key[1:]...)
+			c.hasValue = true
+			return
+		}
+		n, key = n.links[key[0]], key[1:]
 	}
-	t.resolve(n)
 	n.hasValue = true
-	n.hash = nil
 }
 
+// resolve loads the node from the database, following the chain of nodes
+// with a single link and no value into its path.
 func (t *Trie) resolve(n *node) {
 	if n.hash == nil {
 		return
 	}
-	b, err := t.db.Get(n.hash[:], nil)
-	if err == leveldb.ErrNotFound {
+	var path []byte
+	h := n.hash
+	for {
+		b, err := t.db.Get(h[:])
+		if err == storage.ErrNotFound {
+			return
+		} else if err != nil {
+			panic(err)
+		}
+		nb := nbuf(b)
+		if nb.entries() == 1 && !nb.hasValue() {
+			ch, lh := nb.entry(0)
+			path = append(path, ch)
+			h = lh
+			continue
+		}
+		n.path = path
+		n.hasValue = nb.hasValue()
+		n.links = nil
+		for i := 0; i < nb.entries(); i++ {
+			p, h := nb.entry(i)
+			n.link(p).hash = h
+		}
 		return
-	} else if err != nil {
-		panic(err)
-	}
-
-	nb := nbuf(b)
-	n.hasValue = nb.hasValue()
-	for i := 0; i < nb.entries(); i++ {
-		p, h := nb.entry(i)
-		n.links[p] = newNode()
-		n.links[p].hash = h
 	}
 }
 
 // MerkleHash returns the Merkle Hash of the Trie.
 // All nodes must have been resolved before calling this function.
 func (t *Trie) MerkleHash() *chainhash.Hash {
-	t.batch = &leveldb.Batch{}
+	t.batch = &storage.Batch{}
 	buf := make([]byte, 0, 4096)
 	if h := t.merkle(buf, t.root); h == nil {
 		return EmptyTrieHash
 	}
 	if t.batch.Len() != 0 {
-		if err := t.db.Write(t.batch, nil); err != nil {
+		if err := t.db.Write(t.batch); err != nil {
 			panic(err)
 		}
 	}
@@ -99,20 +145,40 @@ func (t *Trie) MerkleHash() *chainhash.Hash {
 
 // merkle recursively resolves the hashes of the node.
 // All nodes must have been resolved before calling this function.
+//
+// The dirty children are handed to idle workers, if any, and hashed by the
+// caller otherwise. The hashes are written in the order of the links
+// regardless, so the result is the same as the sequential one.
 func (t *Trie) merkle(prefix []byte, n *node) *chainhash.Hash {
 	if n.hash != nil {
 		return n.hash
 	}
+	// The links and the value belong to the last node of the chain.
+	prefix = append(prefix, n.path...)
+	var hashes [256]*chainhash.Hash
+	var wg sync.WaitGroup
+	for ch, n := range n.links {
+		if n.hash == nil && t.acquire() {
+			// The worker extends its own copy of the prefix.
+			p := append(make([]byte, 0, cap(prefix)), prefix...)
+			wg.Add(1)
+			go func(ch byte, n *node) {
+				defer wg.Done()
+				defer t.release()
+				hashes[ch] = t.merkle(append(p, ch), n)
+			}(ch, n)
+			continue
+		}
+		hashes[ch] = t.merkle(append(prefix, ch), n)
+	}
+	wg.Wait()
+
 	b := t.bufs.Get().(*bytes.Buffer)
 	defer t.bufs.Put(b)
 	b.Reset()
 
-	for ch, n := range n.links {
-		if n == nil {
-			continue
-		}
-		p := append(prefix, byte(ch))
-		if h := t.merkle(p, n); h != nil {
+	for ch, h := range hashes {
+		if h != nil {
 			b.WriteByte(byte(ch)) // nolint : errchk
 			b.Write(h[:])         // nolint : errchk
 		}
@@ -124,10 +190,41 @@ func (t *Trie) merkle(prefix []byte, n *node) *chainhash.Hash {
 		}
 	}
 
-	if b.Len() != 0 {
-		h := chainhash.DoubleHashH(b.Bytes())
-		n.hash = &h
-		t.batch.Put(h[:], b.Bytes())
+	if b.Len() == 0 {
+		return nil
+	}
+	h := t.put(b.Bytes())
+
+	// Hash the chain back up to the first node, which is linked by the parent.
+	for i := len(n.path) - 1; i >= 0; i-- {
+		b.Reset()
+		b.WriteByte(n.path[i]) // nolint : errchk
+		b.Write(h[:])          // nolint : errchk
+		h = t.put(b.Bytes())
 	}
+	n.hash = h
 	return n.hash
 }
+
+// put writes the node to the batch, and returns its hash.
+func (t *Trie) put(b []byte) *chainhash.Hash {
+	h := chainhash.DoubleHashH(b)
+	t.batchmu.Lock()
+	t.batch.Put(h[:], b)
+	t.batchmu.Unlock()
+	return &h
+}
+
+// acquire takes a token for a worker, if there is an idle one.
+func (t *Trie) acquire() bool {
+	select {
+	case t.workers <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *Trie) release() {
+	<-t.workers
+}
@@ -0,0 +1,139 @@
+package trie
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/lbryio/claimtrie/storage"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+type testValue struct{ h *chainhash.Hash }
+
+func (v testValue) Hash() *chainhash.Hash { return v.h }
+
+// testKV maps the keys to their value hashes. A nil hash is a removed value.
+type testKV map[string]*chainhash.Hash
+
+func (kv testKV) Get(key []byte) Value { return testValue{kv[string(key)]} }
+
+// seqHash hashes the keys sequentially, one node per byte of the keys as the
+// Trie is laid out in the database, and records the nodes in nodes. The keys
+// all start with the prefix. It returns nil if none of the keys has a value.
+func seqHash(kv testKV, keys []string, prefix string, nodes map[chainhash.Hash][]byte) *chainhash.Hash {
+	var children [256][]string
+	for _, k := range keys {
+		if len(k) > len(prefix) {
+			children[k[len(prefix)]] = append(children[k[len(prefix)]], k)
+		}
+	}
+	var b []byte
+	for ch, keys := range children {
+		if len(keys) == 0 {
+			continue
+		}
+		if h := seqHash(kv, keys, prefix+string([]byte{byte(ch)}), nodes); h != nil {
+			b = append(b, byte(ch))
+			b = append(b, h[:]...)
+		}
+	}
+	if h := kv[prefix]; h != nil {
+		b = append(b, h[:]...)
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	h := chainhash.DoubleHashH(b)
+	nodes[h] = b
+	return &h
+}
+
+// checkTrie checks the root and the nodes written to the database against the
+// sequential hash of the keys.
+func checkTrie(t *testing.T, tr *Trie, kv testKV) {
+	var keys []string
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	nodes := map[chainhash.Hash][]byte{}
+	want := seqHash(kv, keys, "", nodes)
+	if want == nil {
+		want = EmptyTrieHash
+	}
+	if got := tr.MerkleHash(); *got != *want {
+		t.Fatalf("root %s, want %s", got, want)
+	}
+	for h, b := range nodes {
+		got, err := tr.db.Get(h[:])
+		if err != nil {
+			t.Fatalf("node %s: %s", h, err)
+		}
+		if !bytes.Equal(got, b) {
+			t.Fatalf("node %s is %x, want %x", h, got, b)
+		}
+	}
+}
+
+func TestMerkleHash(t *testing.T) {
+	// Each step splits or collapses the paths of the ones before.
+	steps := []struct {
+		key   string
+		value byte
+	}{
+		{"abcd", 1},
+		{"ab", 2},   // splits abcd
+		{"abx", 3},  // splits it again below ab
+		{"", 4},     // the root has a value
+		{"abx", 0},  // collapses ab back to a chain
+		{"ab", 0},   // collapses the path to abcd
+		{"abcd", 0}, // empties the trie but the root
+		{"", 0},
+	}
+	kv := testKV{}
+	tr := New(kv, storage.NewMemDB())
+	for _, s := range steps {
+		kv[s.key] = nil
+		if s.value != 0 {
+			kv[s.key] = &chainhash.Hash{s.value}
+		}
+		tr.Update([]byte(s.key))
+		checkTrie(t, tr, kv)
+	}
+}
+
+// TestMerkleHashRandom checks the Trie hashes the same as the sequential hash
+// over random keys sharing their prefixes, with several numbers of workers.
+// The keys are updated, removed and added back, so the paths are split and
+// collapsed, and the Trie is reloaded from its root now and then.
+func TestMerkleHashRandom(t *testing.T) {
+	alphabet := []byte{'a', 'b', 'c', 0x00, 0xff}
+	for _, workers := range []int{1, 2, 8} {
+		r := rand.New(rand.NewSource(1))
+		db := storage.NewMemDB()
+		kv := testKV{}
+		tr := New(kv, db)
+		tr.SetWorkers(workers)
+		for round := 0; round < 50; round++ {
+			if round%7 == 6 {
+				root := tr.MerkleHash()
+				tr = New(kv, db)
+				tr.SetWorkers(workers)
+				tr.SetRoot(root)
+			}
+			for i := r.Intn(30); i >= 0; i-- {
+				key := make([]byte, r.Intn(8))
+				for j := range key {
+					key[j] = alphabet[r.Intn(len(alphabet))]
+				}
+				kv[string(key)] = &chainhash.Hash{byte(round), byte(i)}
+				if r.Intn(3) == 0 {
+					kv[string(key)] = nil
+				}
+				tr.Update(key)
+			}
+			checkTrie(t, tr, kv)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package trie
+
+import (
+	"bytes"
+
+	"github.com/lbryio/claimtrie/storage"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/pkg/errors"
+)
+
+// WalkFunc visits a key and its value hash. If it returns true, the walk ends immediately.
+type WalkFunc func(key []byte, value *chainhash.Hash) (stop bool)
+
+// Walk visits the keys in the range [start, end) in lexicographical order,
+// in the Trie with specified root hash. A nil end has no upper bound.
+// Only the keys having values are visited. The nodes are read from the
+// database, so the root has to be produced by MerkleHash().
+func (t *Trie) Walk(root *chainhash.Hash, start, end []byte, visit WalkFunc) error {
+	if root == nil || *root == *EmptyTrieHash {
+		return nil
+	}
+	_, err := t.walk(root, make([]byte, 0, 64), start, end, visit)
+	return err
+}
+
+// WalkPrefix visits the keys with the prefix in lexicographical order, in the
+// Trie with specified root hash.
+func (t *Trie) WalkPrefix(root *chainhash.Hash, prefix []byte, visit WalkFunc) error {
+	return t.Walk(root, prefix, prefixEnd(prefix), visit)
+}
+
+// prefixEnd returns the smallest key larger than all keys with the prefix,
+// or nil if there is none.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+func (t *Trie) walk(h *chainhash.Hash, key, start, end []byte, visit WalkFunc) (bool, error) {
+	if end != nil && bytes.Compare(key, end) >= 0 {
+		return true, nil
+	}
+	// All keys of the subtree are less than start.
+	if bytes.Compare(key, start) < 0 && !bytes.HasPrefix(start, key) {
+		return false, nil
+	}
+	nb, err := t.nbuf(h)
+	if err != nil {
+		return false, err
+	}
+	if v := nb.value(); v != nil && bytes.Compare(key, start) >= 0 {
+		if visit(append([]byte(nil), key...), v) {
+			return true, nil
+		}
+	}
+	for i := 0; i < nb.entries(); i++ {
+		ch, lh := nb.entry(i)
+		if stop, err := t.walk(lh, append(key, ch), start, end, visit); stop || err != nil {
+			return stop, err
+		}
+	}
+	return false, nil
+}
+
+// nbuf reads the node of hash h from the database.
+func (t *Trie) nbuf(h *chainhash.Hash) (nbuf, error) {
+	b, err := t.db.Get(h[:])
+	if err == storage.ErrNotFound {
+		return nil, errors.Wrapf(ErrMissingNode, "node %s", h)
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "db.Get(%s)", h)
+	}
+	return nbuf(b), nil
+}
@@ -0,0 +1,113 @@
+package claimtrie
+
+import (
+	"sort"
+
+	"github.com/lbryio/claimtrie/cfg"
+	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/storage"
+	"github.com/lbryio/claimtrie/trie"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/pkg/errors"
+)
+
+// Verify checks the consistency of the databases at the Head commit.
+func (ct *ClaimTrie) Verify(mode cfg.VerifyMode) error {
+	if mode == cfg.VerifyNone {
+		return nil
+	}
+	head := ct.Head()
+	tip, err := ct.nm.Tip()
+	if err != nil {
+		return errors.Wrapf(err, "nm.Tip()")
+	}
+	if tip > head.Meta.Height {
+		return errors.Wrapf(ErrInconsistent, "node database has changes at %d, head at %d", tip, head.Meta.Height)
+	}
+	if _, err := ct.tr.Prove(head.MerkleRoot, nil); err != nil {
+		return errors.Wrapf(ErrInconsistent, "root of head: %s", err)
+	}
+	if mode == cfg.VerifyQuick {
+		return nil
+	}
+	if h := ct.rebuild(head.Meta.Height, storage.NewMemDB()); *h != *head.MerkleRoot {
+		return errors.Wrapf(ErrInconsistent, "node database replays to %s, head has %s", h, head.MerkleRoot)
+	}
+	return nil
+}
+
+// Repair repairs the databases with the specified mode.
+// In both modes, changes beyond the Head commit are dropped from the node
+// database, since they have never been committed.
+func (ct *ClaimTrie) Repair(mode cfg.RepairMode) error {
+	tip, err := ct.nm.Tip()
+	if err != nil {
+		return errors.Wrapf(err, "nm.Tip()")
+	}
+	if tip > ct.Height() {
+		if err := ct.nm.Truncate(ct.Height()); err != nil {
+			return errors.Wrapf(err, "nm.Truncate(%d)", ct.Height())
+		}
+	}
+	switch mode {
+	case cfg.RepairRebuildTrie:
+		head := ct.Head()
+		if h := ct.rebuild(head.Meta.Height, ct.bufs[0]); *h != *head.MerkleRoot {
+			return errors.Wrapf(ErrInconsistent, "rebuilt root %s, head has %s", h, head.MerkleRoot)
+		}
+	case cfg.RepairTruncate:
+		good, err := ct.lastConsistent()
+		if err != nil {
+			return err
+		}
+		ht := good.Meta.Height
+		if err := ct.nm.Truncate(ht); err != nil {
+			return errors.Wrapf(err, "nm.Truncate(%d)", ht)
+		}
+		if _, err := ct.cm.Reset(ht); err != nil {
+			return errors.Wrapf(err, "cm.Reset(%d)", ht)
+		}
+		ct.rebuild(ht, ct.bufs[0])
+	default:
+		return errors.Errorf("unknown repair mode: %d", mode)
+	}
+	ct.tr.SetRoot(ct.Head().MerkleRoot)
+	return errors.Wrapf(ct.flush(), "flush()")
+}
+
+// lastConsistent returns the highest commit which the node database replays
+// to. Each check replays all nodes, so the commits are bisected rather than
+// checked one by one. The corruption is assumed to affect the latest commits,
+// which is the case for the writes lost or left over by a crash.
+func (ct *ClaimTrie) lastConsistent() (*Commit, error) {
+	var commits []*Commit
+	err := ct.cm.Log(ct.Height(), func(c *Commit) bool {
+		commits = append(commits, c)
+		return false
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cm.Log()")
+	}
+	// The commits are from the Head down, so the consistent ones follow the
+	// inconsistent ones.
+	i := sort.Search(len(commits), func(i int) bool {
+		c := commits[i]
+		return *ct.rebuild(c.Meta.Height, storage.NewMemDB()) == *c.MerkleRoot
+	})
+	if i == len(commits) {
+		return nil, errors.Wrapf(ErrInconsistent, "no consistent commit found")
+	}
+	return commits[i], nil
+}
+
+// rebuild builds the trie of the nodes at height ht from scratch into db,
+// and returns its root hash. The nodes are replayed from all of their
+// changes, regardless of the snapshots.
+func (ct *ClaimTrie) rebuild(ht claim.Height, db storage.DB) *chainhash.Hash {
+	tr := trie.New(ct.nm.ReplayAt(ht), db)
+	for _, name := range ct.nm.Names() {
+		tr.Update([]byte(name))
+	}
+	return tr.MerkleHash()
+}
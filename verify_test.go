@@ -0,0 +1,69 @@
+package claimtrie
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/lbryio/claimtrie/cfg"
+	"github.com/lbryio/claimtrie/change"
+	"github.com/lbryio/claimtrie/claim"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+func TestRepairTruncate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claimtrie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Each height takes a new name, so a corrupted claim changes the roots
+	// from its height on.
+	ct := openTestClaimTrie(t, dir)
+	roots := map[claim.Height]chainhash.Hash{}
+	for ht := claim.Height(1); ht <= 100; ht++ {
+		op := *claim.NewOutPoint(&chainhash.Hash{byte(ht)}, 0)
+		if err := ct.AddClaim(fmt.Sprintf("name%d", ht), op, 1, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := ct.Commit(ht); err != nil {
+			t.Fatal(err)
+		}
+		roots[ht] = *ct.MerkleHash()
+	}
+	if err := ct.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := cfg.DefaultConfig()
+	c.DataDir = dir
+	c.Params = claim.RegTestParams
+	c.Logger = nil
+	db, err := c.Open(cfg.NodeDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := change.NewChangeList(db, "name61").Load()
+	cl.Changes()[0].OP.Index++
+	if err := cl.Save().Err(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close() // nolint : errchk
+
+	c.Verify = cfg.VerifyFull
+	if _, err := New(c); err == nil {
+		t.Fatal("corrupted node database verified")
+	}
+	c.Repair = cfg.RepairTruncate
+	ct, err = New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ct.Close() // nolint : errchk
+	if ct.Height() != 60 || *ct.MerkleHash() != roots[60] {
+		t.Fatalf("repaired to %d with root %s, want 60 with %s", ct.Height(), ct.MerkleHash(), roots[60])
+	}
+}
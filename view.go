@@ -0,0 +1,180 @@
+package claimtrie
+
+import (
+	"strings"
+
+	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/proof"
+	"github.com/lbryio/claimtrie/resolve"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/pkg/errors"
+)
+
+// View is a read-only view of the ClaimTrie as of a commit.
+//
+// The nodes are rebuilt from the databases, bypassing the cache, and the names
+// and proofs are read from the trie committed at the height. So the View stays
+// consistent while the ClaimTrie advances, and can be queried concurrently.
+// Resetting the ClaimTrie below the height invalidates the View, and so does
+// pruning the trie of an unpinned commit.
+type View struct {
+	ct   *ClaimTrie
+	ht   claim.Height
+	root *chainhash.Hash
+}
+
+// At returns a read-only View of the ClaimTrie as of the commit at height ht.
+func (ct *ClaimTrie) At(ht claim.Height) (*View, error) {
+	if err := ct.checkHeight(ht); err != nil {
+		return nil, err
+	}
+	c, err := ct.cm.At(ht)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cm.At(%d)", ht)
+	}
+	return &View{ct: ct, ht: ht, root: c.MerkleRoot}, nil
+}
+
+// Height returns the height of the View.
+func (v *View) Height() claim.Height {
+	return v.ht
+}
+
+// MerkleHash returns the Merkle Hash committed at the height of the View.
+func (v *View) MerkleHash() *chainhash.Hash {
+	return v.root
+}
+
+// Params returns the parameters governing the nodes.
+func (v *View) Params() *claim.Params {
+	return v.ct.Params()
+}
+
+// Node returns the node of the name, which is normalized after the
+// normalization fork.
+func (v *View) Node(name string) *claim.Node {
+	return v.node(v.Params().NormalizeName(name, v.ht))
+}
+
+func (v *View) node(name string) *claim.Node {
+	return v.ct.nm.Rebuild(name, v.ht)
+}
+
+// ResolveName returns the best claim of the name.
+func (v *View) ResolveName(name string) (*Result, error) {
+	n := v.Node(name)
+	if n.BestClaim() == nil {
+		return nil, errors.Wrapf(ErrClaimNotFound, "name %s at %d", name, v.ht)
+	}
+	return newResult(n, n.BestClaim()), nil
+}
+
+// ResolveID returns the claim of the id, along with the name it's under.
+// The index, which reflects the Head, leads to the claim if it hasn't moved
+// since. Otherwise, all nodes are rebuilt and scanned, which takes time in
+// proportion to the whole node database.
+func (v *View) ResolveID(id claim.ID) (*Result, error) {
+	if name, err := v.ct.nm.NameOf(id); err == nil {
+		n := v.node(name)
+		if c := claim.Find(claim.ByID(id), n.Claims()); c != nil {
+			return newResult(n, c), nil
+		}
+	}
+	var res *Result
+	visitClaims(v.ct.nm.Names(), v.node, func(n *claim.Node, c *claim.Claim) bool {
+		if c.ID == id {
+			res = newResult(n, c)
+		}
+		return res != nil
+	})
+	if res == nil {
+		return nil, errors.Wrapf(ErrClaimNotFound, "id %s at %d", id, v.ht)
+	}
+	return res, nil
+}
+
+// ResolvePrefix returns the claim whose ID, in the hexadecimal form, starts
+// with the prefix. It returns ErrAmbiguousID if more than one claim matches,
+// and claim.ErrInvalidID if the prefix isn't a valid one.
+// All nodes are rebuilt and scanned, as the index only reflects the Head,
+// which takes time in proportion to the whole node database.
+func (v *View) ResolvePrefix(prefix string) (*Result, error) {
+	if err := claim.CheckIDPrefix(prefix); err != nil {
+		return nil, errors.Wrapf(err, "prefix %s", prefix)
+	}
+	prefix = strings.ToLower(prefix)
+	var res *Result
+	var err error
+	visitClaims(v.ct.nm.Names(), v.node, func(n *claim.Node, c *claim.Claim) bool {
+		if !strings.HasPrefix(c.ID.String(), prefix) {
+			return false
+		}
+		if res != nil {
+			err = errors.Wrapf(ErrAmbiguousID, "prefix %s matches %s and %s", prefix, res.Claim.ID, c.ID)
+			return true
+		}
+		res = newResult(n, c)
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, errors.Wrapf(ErrClaimNotFound, "prefix %s at %d", prefix, v.ht)
+	}
+	return res, nil
+}
+
+// ResolveURL resolves the LBRY URL, such as name#abc, name:3 or name$2.
+func (v *View) ResolveURL(url string) (*resolve.Result, error) {
+	return resolve.New(viewNodes{v}).Resolve(url, v.ht)
+}
+
+// viewNodes serves the nodes of the View to the resolver, which queries them
+// at the height of the View.
+type viewNodes struct {
+	v *View
+}
+
+func (vn viewNodes) Params() *claim.Params {
+	return vn.v.Params()
+}
+
+func (vn viewNodes) NodeAt(name string, ht claim.Height) *claim.Node {
+	return vn.v.ct.nm.Rebuild(name, ht)
+}
+
+// WalkNames visits the names in the range [start, end) in lexicographical
+// order. An empty end has no upper bound.
+func (v *View) WalkNames(start, end string, visit NameVisit) error {
+	var last []byte
+	if end != "" {
+		last = []byte(end)
+	}
+	return v.ct.tr.Walk(v.root, []byte(start), last, func(key []byte, _ *chainhash.Hash) bool {
+		return visit(string(key))
+	})
+}
+
+// WalkPrefix visits the names starting with the prefix in lexicographical
+// order. The prefix is normalized after the normalization fork.
+func (v *View) WalkPrefix(prefix string, visit NameVisit) error {
+	prefix = v.Params().NormalizeName(prefix, v.ht)
+	return v.ct.tr.WalkPrefix(v.root, []byte(prefix), func(key []byte, _ *chainhash.Hash) bool {
+		return visit(string(key))
+	})
+}
+
+// Prove returns a Proof of the name against the Merkle Hash of the View.
+func (v *View) Prove(name string) (*proof.Proof, error) {
+	name = v.Params().NormalizeName(name, v.ht)
+	return v.ct.tr.Prove(v.root, []byte(name))
+}
+
+// ProveClaim returns a Proof of the claim of id under the name against the
+// Merkle Hash of the View.
+// Before the AllClaimsInMerkleForkHeight, only the best claim can be proved.
+func (v *View) ProveClaim(name string, id claim.ID) (*proof.Proof, error) {
+	return v.ct.proveClaim(v.Node(name), v.root, id)
+}
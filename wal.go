@@ -0,0 +1,78 @@
+package claimtrie
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/lbryio/claimtrie/claim"
+	"github.com/lbryio/claimtrie/storage"
+
+	"github.com/pkg/errors"
+)
+
+var walKey = []byte("WAL")
+
+// walRecord holds the writes of a commit to each database.
+type walRecord struct {
+	Height  claim.Height
+	Batches []*storage.Batch
+}
+
+// flush writes the pending writes of all databases atomically.
+//
+// The writes are first recorded to the write-ahead log in the commit database
+// with a single write, and then applied to each database. The log is removed
+// once all databases have been written. If the process crashes in between,
+// the log is replayed by recoverWAL() on the next start.
+func (ct *ClaimTrie) flush() error {
+	rec := walRecord{Height: ct.Height()}
+	empty := true
+	for _, b := range ct.bufs {
+		batch := b.Pending()
+		empty = empty && batch.Len() == 0
+		rec.Batches = append(rec.Batches, batch)
+	}
+	if empty {
+		return nil
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(rec); err != nil {
+		return errors.Wrapf(err, "gob.Encode()")
+	}
+	wal := ct.bufs[2].Unwrap()
+	if err := wal.Put(walKey, buf.Bytes()); err != nil {
+		return errors.Wrapf(err, "db.Put(WAL)")
+	}
+	for i, b := range ct.bufs {
+		if err := b.Unwrap().Write(rec.Batches[i]); err != nil {
+			return errors.Wrapf(err, "db.Write(%d)", i)
+		}
+		b.Discard()
+	}
+	return errors.Wrapf(wal.Delete(walKey), "db.Delete(WAL)")
+}
+
+// recoverWAL replays the write-ahead log left by an interrupted flush, if any.
+// It returns the height of the recovered commit, or -1 if there is nothing to recover.
+func recoverWAL(wal storage.DB, dbs []storage.DB) (claim.Height, error) {
+	data, err := wal.Get(walKey)
+	if err == storage.ErrNotFound {
+		return -1, nil
+	} else if err != nil {
+		return -1, errors.Wrapf(err, "db.Get(WAL)")
+	}
+	var rec walRecord
+	if err = gob.NewDecoder(bytes.NewBuffer(data)).Decode(&rec); err != nil {
+		return -1, errors.Wrapf(err, "gob.Decode()")
+	}
+	if len(rec.Batches) > len(dbs) {
+		return -1, errors.Errorf("WAL has %d batches, want at most %d", len(rec.Batches), len(dbs))
+	}
+	for i, batch := range rec.Batches {
+		if err = dbs[i].Write(batch); err != nil {
+			return -1, errors.Wrapf(err, "db.Write(%d)", i)
+		}
+	}
+	return rec.Height, errors.Wrapf(wal.Delete(walKey), "db.Delete(WAL)")
+}